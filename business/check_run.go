@@ -0,0 +1,262 @@
+package business
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"github.com/rs/zerolog"
+	"strings"
+	"time"
+)
+
+const (
+	// CheckRunName is the name of the check run reporting the preview, which
+	// branch protection rules can require.
+	CheckRunName = "Preview"
+
+	// RerequestedAction is sent when a user re-runs the preview check.
+	RerequestedAction = "rerequested"
+	// RequestedAction is sent when a user clicks one of the check's buttons.
+	RequestedAction = "requested_action"
+
+	// identifiers of the preview check's buttons.
+	RedeployButton = "redeploy"
+	DestroyButton  = "destroy"
+
+	// maxLogLines and maxLogBytes bound the failure log shown on the check.
+	maxLogLines = 50
+	maxLogBytes = 60000
+)
+
+// checkRunButtons are offered on the preview check, so reviewers can control
+// the preview from the Checks tab. There is no "Extend TTL" button yet:
+// previews live until the pull request is closed, so there is nothing to
+// extend.
+var checkRunButtons = []*github.CheckRunAction{
+	{Label: "Redeploy", Description: "Rebuild the preview from this commit", Identifier: RedeployButton},
+	{Label: "Destroy preview", Description: "Remove the preview", Identifier: DestroyButton},
+}
+
+// Checks reports previews as check runs on the pull request head. A nil
+// Checks reports nothing.
+type Checks struct{}
+
+// Start creates the preview check run and marks it in progress.
+func (c *Checks) Start(ctx context.Context, client *github.Client, event github.PullRequestEvent) (Report, error) {
+	if c == nil {
+		return noReport{}, nil
+	}
+	p := &PreviewCheck{
+		client: client,
+		owner:  event.GetRepo().GetOwner().GetLogin(),
+		repo:   event.GetRepo().GetName(),
+		event:  event,
+	}
+	run, _, err := client.Checks.CreateCheckRun(ctx, p.owner, p.repo, github.CreateCheckRunOptions{
+		Name:      CheckRunName,
+		HeadSHA:   event.GetPullRequest().GetHead().GetSHA(),
+		Status:    github.String("in_progress"),
+		StartedAt: &github.Timestamp{Time: time.Now()},
+		Output: &github.CheckRunOutput{
+			Title:   github.String("Deploying preview"),
+			Summary: github.String(checkSummary(event, "")),
+		},
+		Actions: checkRunButtons,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.id = run.GetID()
+	return p, nil
+}
+
+// Retire completes a new preview check run as neutral, so the head stops
+// linking to the removed preview. Redeploy is offered while the pull
+// request is open.
+func (c *Checks) Retire(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	if c == nil {
+		return nil
+	}
+	var actions []*github.CheckRunAction
+	if event.GetPullRequest().GetState() != "closed" {
+		actions = checkRunButtons[:1]
+	}
+	_, _, err := client.Checks.CreateCheckRun(ctx, event.GetRepo().GetOwner().GetLogin(), event.GetRepo().GetName(), github.CreateCheckRunOptions{
+		Name:        CheckRunName,
+		HeadSHA:     event.GetPullRequest().GetHead().GetSHA(),
+		Status:      github.String("completed"),
+		Conclusion:  github.String("neutral"),
+		CompletedAt: &github.Timestamp{Time: time.Now()},
+		Output: &github.CheckRunOutput{
+			Title:   github.String("Preview destroyed"),
+			Summary: github.String(checkSummary(event, "")),
+		},
+		Actions: actions,
+	})
+	return err
+}
+
+// PreviewCheck is a check run created by Checks.
+type PreviewCheck struct {
+	client *github.Client
+	owner  string
+	repo   string
+	id     int64
+	event  github.PullRequestEvent
+}
+
+// Succeed completes the check run with a link to the preview.
+func (p *PreviewCheck) Succeed(ctx context.Context, previewURL string) error {
+	return p.complete(ctx, "success", previewURL, &github.CheckRunOutput{
+		Title:   github.String("Preview is live"),
+		Summary: github.String(checkSummary(p.event, previewURL)),
+	})
+}
+
+// Fail completes the check run with an excerpt of cause and returns cause.
+// Failing to report the failure is only logged, so cause is what gets
+// retried or reported.
+func (p *PreviewCheck) Fail(ctx context.Context, cause error) error {
+	err := p.complete(ctx, "failure", "", &github.CheckRunOutput{
+		Title:   github.String("Preview failed"),
+		Summary: github.String(checkSummary(p.event, "")),
+		Text:    github.String("```\n" + logExcerpt(cause.Error()) + "\n```"),
+	})
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Int64("check_run", p.id).Msg("failed to report check run failure")
+	}
+	return cause
+}
+
+func (p *PreviewCheck) complete(ctx context.Context, conclusion, detailsURL string, output *github.CheckRunOutput) error {
+	opts := github.UpdateCheckRunOptions{
+		Name:        CheckRunName,
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		CompletedAt: &github.Timestamp{Time: time.Now()},
+		Output:      output,
+		Actions:     checkRunButtons,
+	}
+	if detailsURL != "" {
+		opts.DetailsURL = github.String(detailsURL)
+	}
+	_, _, err := p.client.Checks.UpdateCheckRun(ctx, p.owner, p.repo, p.id, opts)
+	return err
+}
+
+// checkSummary describes the preview in a Markdown table.
+func checkSummary(event github.PullRequestEvent, previewURL string) string {
+	pr := event.GetPullRequest()
+	preview := "-"
+	if previewURL != "" {
+		preview = fmt.Sprintf("[%s](%s)", previewURL, previewURL)
+	}
+	var b strings.Builder
+	b.WriteString("| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Pull request | #%d |\n", event.GetNumber())
+	fmt.Fprintf(&b, "| Commit | `%s` |\n", shortSHA(pr.GetHead().GetSHA()))
+	fmt.Fprintf(&b, "| Branch | `%s` → `%s` |\n", tableCell(pr.GetHead().GetRef()), tableCell(pr.GetBase().GetRef()))
+	fmt.Fprintf(&b, "| Preview | %s |\n", preview)
+	return b.String()
+}
+
+// logExcerpt keeps the end of a failure log, where the cause usually is.
+func logExcerpt(log string) string {
+	lines := strings.Split(strings.TrimRight(log, "\n"), "\n")
+	if len(lines) > maxLogLines {
+		lines = lines[len(lines)-maxLogLines:]
+	}
+	excerpt := strings.Join(lines, "\n")
+	if len(excerpt) > maxLogBytes {
+		excerpt = excerpt[len(excerpt)-maxLogBytes:]
+	}
+	// a fence in the log would end the code block early.
+	return strings.ReplaceAll(excerpt, "```", "'''")
+}
+
+// CheckRunHandler controls the preview from its check run: re-running the
+// check or clicking Redeploy rebuilds it, and clicking Destroy preview
+// removes it.
+type CheckRunHandler struct {
+	SynchronizeHandler *PRSynchronizeHandler
+	CloseHandler       *PRCloseHandler
+	// Permissions decides who may control previews. Only users with write
+	// permission are allowed when it is nil.
+	Permissions *PermissionChecker
+	// Filter refuses redeploys of pull requests the event filter skips, such
+	// as forks. Any open pull request can be redeployed when it is nil.
+	Filter *EventFilter
+}
+
+// Handle handles the check run event for pull request number, one of the
+// pull requests the check run belongs to.
+func (h *CheckRunHandler) Handle(ctx context.Context, client *github.Client, event github.CheckRunEvent, number int) error {
+	run := event.GetCheckRun()
+	if run.GetName() != CheckRunName {
+		return nil
+	}
+	var button string
+	switch event.GetAction() {
+	case RerequestedAction:
+		button = RedeployButton
+	case RequestedAction:
+		button = event.GetRequestedAction().Identifier
+	default:
+		return nil
+	}
+	logger := zerolog.Ctx(ctx).With().Str("button", button).Logger()
+
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	allowed, reason, err := h.permissions().Authorize(ctx, client, owner, repo, event.GetSender().GetLogin())
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		logger.Info().Str("skip_reason", reason).Msg("ignoring check run from an unauthorized user")
+		return nil
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+	if err != nil {
+		return err
+	}
+	prEvent := github.PullRequestEvent{
+		Number:       &number,
+		PullRequest:  pr,
+		Repo:         event.GetRepo(),
+		Sender:       event.GetSender(),
+		Installation: event.GetInstallation(),
+	}
+	switch button {
+	case RedeployButton:
+		if pr.GetHead().GetSHA() != run.GetHeadSHA() {
+			logger.Info().Msg("ignoring redeploy of an outdated commit")
+			return nil
+		}
+		if reason := previewBlocked(pr); reason != "" {
+			logger.Info().Str("skip_reason", reason).Msg("ignoring redeploy without a preview")
+			return nil
+		}
+		if reason := filterRedeploy(h.Filter, prEvent); reason != "" {
+			logger.Info().Str("skip_reason", reason).Msg("refusing redeploy of a filtered pull request")
+			return postComment(ctx, client, prEvent, "cannot redeploy: "+reason)
+		}
+		return h.SynchronizeHandler.Handle(ctx, client, prEvent)
+	case DestroyButton:
+		if pr.GetState() == "closed" {
+			logger.Info().Msg("ignoring destroy of a closed pull request")
+			return nil
+		}
+		return h.CloseHandler.Handle(ctx, client, prEvent)
+	}
+	logger.Info().Msg("ignoring unknown check run button")
+	return nil
+}
+
+func (h *CheckRunHandler) permissions() *PermissionChecker {
+	if h.Permissions == nil {
+		return &PermissionChecker{MinPermission: PermissionWrite}
+	}
+	return h.Permissions
+}
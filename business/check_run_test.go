@@ -0,0 +1,295 @@
+package business
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/go-github/v47/github"
+	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// checksClient serves pr, grants the sender write permission and records the check runs created and updated and
+// the comments posted, failing comments when commentErr is set.
+func checksClient(t *testing.T, pr github.PullRequest, created *[]github.CreateCheckRunOptions, updated *[]github.UpdateCheckRunOptions, comments *int, commentErr bool) *github.Client {
+	decode := func(r *http.Request, v interface{}) {
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(b, v))
+	}
+	return github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatch(mock.GetReposPullsByOwnerByRepoByPullNumber, pr),
+		mock.WithRequestMatch(
+			mock.GetReposCollaboratorsPermissionByOwnerByRepoByUsername,
+			collaboratorPermission{Permission: "write", RoleName: "write"},
+		),
+		mock.WithRequestMatchHandler(mock.PostReposCheckRunsByOwnerByRepo, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var opts github.CreateCheckRunOptions
+			decode(r, &opts)
+			*created = append(*created, opts)
+			w.Write(mock.MustMarshal(github.CheckRun{ID: github.Int64(7)}))
+		})),
+		mock.WithRequestMatchHandler(mock.PatchReposCheckRunsByOwnerByRepoByCheckRunId, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var opts github.UpdateCheckRunOptions
+			decode(r, &opts)
+			*updated = append(*updated, opts)
+			w.Write(mock.MustMarshal(github.CheckRun{ID: github.Int64(7)}))
+		})),
+		mock.WithRequestMatchHandler(mock.GetReposIssuesCommentsByOwnerByRepoByIssueNumber, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(mock.MustMarshal([]github.IssueComment{}))
+		})),
+		mock.WithRequestMatchHandler(mock.PostReposIssuesCommentsByOwnerByRepoByIssueNumber, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*comments++
+			if commentErr {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"message":"github fail whale\nfrom the build"}`))
+				return
+			}
+			w.Write(mock.MustMarshal(github.IssueComment{}))
+		})),
+	))
+}
+
+func TestPublishPreview_Checks(t *testing.T) {
+	tests := []struct {
+		name           string
+		commentErr     bool
+		wantConclusion string
+		wantDetailsURL string
+		wantText       string
+	}{
+		{
+			name:           "live preview",
+			wantConclusion: "success",
+			wantDetailsURL: "https://pr-10.example.com",
+		},
+		{
+			name:           "failed preview",
+			commentErr:     true,
+			wantConclusion: "failure",
+			wantText:       "github fail whale",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []github.CreateCheckRunOptions
+			var updated []github.UpdateCheckRunOptions
+			var comments int
+			client := checksClient(t, github.PullRequest{}, &created, &updated, &comments, tt.commentErr)
+			event := stickyEvent("0123456789abcdef")
+			err := publishPreview(context.Background(), client, nil, nil, &Checks{}, event, "https://pr-10.example.com", "preview your site")
+			assert.Equal(t, tt.commentErr, err != nil)
+			if assert.Len(t, created, 1) && assert.Len(t, updated, 1) {
+				assert.Equal(t, CheckRunName, created[0].Name)
+				assert.Equal(t, "0123456789abcdef", created[0].HeadSHA)
+				assert.Equal(t, "in_progress", created[0].GetStatus())
+				assert.Equal(t, "completed", updated[0].GetStatus())
+				assert.Equal(t, tt.wantConclusion, updated[0].GetConclusion())
+				assert.Equal(t, tt.wantDetailsURL, updated[0].GetDetailsURL())
+				assert.Contains(t, updated[0].Output.GetSummary(), "| Commit | `0123456` |")
+				assert.Contains(t, updated[0].Output.GetText(), tt.wantText)
+				assert.Len(t, updated[0].Actions, len(checkRunButtons))
+			}
+		})
+	}
+}
+
+func TestRetirePreview_Checks(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       string
+		wantActions int
+	}{
+		{name: "open pull request", state: "open", wantActions: 1},
+		{name: "closed pull request", state: "closed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []github.CreateCheckRunOptions
+			var updated []github.UpdateCheckRunOptions
+			var comments int
+			client := checksClient(t, github.PullRequest{}, &created, &updated, &comments, false)
+			event := stickyEvent("0123456789abcdef")
+			event.PullRequest.State = stringRef(tt.state)
+			err := retirePreview(context.Background(), client, nil, nil, &Checks{}, event, "https://pr-10.example.com", "your site has been cleaned up")
+			assert.NoError(t, err)
+			assert.Empty(t, updated)
+			if assert.Len(t, created, 1) {
+				assert.Equal(t, "completed", created[0].GetStatus())
+				assert.Equal(t, "neutral", created[0].GetConclusion())
+				assert.Empty(t, created[0].GetDetailsURL())
+				assert.Len(t, created[0].Actions, tt.wantActions)
+			}
+		})
+	}
+}
+
+func TestLogExcerpt(t *testing.T) {
+	var lines []string
+	for i := 0; i < 2*maxLogLines; i++ {
+		lines = append(lines, "line")
+	}
+	lines = append(lines, "```fatal```")
+	excerpt := logExcerpt(strings.Join(lines, "\n") + "\n")
+	assert.Len(t, strings.Split(excerpt, "\n"), maxLogLines)
+	assert.True(t, strings.HasSuffix(excerpt, "'''fatal'''"))
+}
+
+func TestCheckRunHandler_Handle(t *testing.T) {
+	head := &github.PullRequestBranch{Ref: stringRef("feature"), SHA: stringRef("0123456789abcdef")}
+	open := github.PullRequest{Number: intRef(10), State: stringRef("open"), Head: head}
+	closed := github.PullRequest{Number: intRef(10), State: stringRef("closed"), Head: head}
+	fork := open
+	fork.Head = &github.PullRequestBranch{Ref: head.Ref, SHA: head.SHA, Repo: &github.Repository{Fork: boolRef(true)}}
+	tests := []struct {
+		name           string
+		action         string
+		button         string
+		checkName      string
+		sha            string
+		pr             github.PullRequest
+		permissions    *PermissionChecker
+		filter         *EventFilter
+		wantComments   int
+		wantChecks     int
+		wantConclusion string
+	}{
+		{
+			name:           "re-run rebuilds the preview",
+			action:         RerequestedAction,
+			checkName:      CheckRunName,
+			sha:            "0123456789abcdef",
+			pr:             open,
+			wantComments:   1,
+			wantChecks:     1,
+			wantConclusion: "success",
+		},
+		{
+			name:           "redeploy button",
+			action:         RequestedAction,
+			button:         RedeployButton,
+			checkName:      CheckRunName,
+			sha:            "0123456789abcdef",
+			pr:             open,
+			wantComments:   1,
+			wantChecks:     1,
+			wantConclusion: "success",
+		},
+		{
+			name:           "destroy button",
+			action:         RequestedAction,
+			button:         DestroyButton,
+			checkName:      CheckRunName,
+			sha:            "0123456789abcdef",
+			pr:             open,
+			wantComments:   1,
+			wantChecks:     1,
+			wantConclusion: "neutral",
+		},
+		{
+			name:      "destroy button on a closed pull request",
+			action:    RequestedAction,
+			button:    DestroyButton,
+			checkName: CheckRunName,
+			sha:       "0123456789abcdef",
+			pr:        closed,
+		},
+		{
+			name:        "unauthorized user",
+			action:      RequestedAction,
+			button:      DestroyButton,
+			checkName:   CheckRunName,
+			sha:         "0123456789abcdef",
+			pr:          open,
+			permissions: &PermissionChecker{MinPermission: PermissionAdmin},
+		},
+		{
+			name:      "unknown button",
+			action:    RequestedAction,
+			button:    "extend",
+			checkName: CheckRunName,
+			sha:       "0123456789abcdef",
+			pr:        open,
+		},
+		{
+			name:         "redeploy of a filtered fork",
+			action:       RequestedAction,
+			button:       RedeployButton,
+			checkName:    CheckRunName,
+			sha:          "0123456789abcdef",
+			pr:           fork,
+			filter:       &EventFilter{SkipForks: true, Registry: metrics.NewRegistry()},
+			wantComments: 1,
+		},
+		{
+			name:      "outdated commit",
+			action:    RerequestedAction,
+			checkName: CheckRunName,
+			sha:       "fedcba9876543210",
+			pr:        open,
+		},
+		{
+			name:      "closed pull request",
+			action:    RerequestedAction,
+			checkName: CheckRunName,
+			sha:       "0123456789abcdef",
+			pr:        closed,
+		},
+		{
+			name:      "another check",
+			action:    RerequestedAction,
+			checkName: "lint",
+			sha:       "0123456789abcdef",
+			pr:        open,
+		},
+		{
+			name:      "completed check",
+			action:    "completed",
+			checkName: CheckRunName,
+			sha:       "0123456789abcdef",
+			pr:        open,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []github.CreateCheckRunOptions
+			var updated []github.UpdateCheckRunOptions
+			var comments int
+			client := checksClient(t, tt.pr, &created, &updated, &comments, false)
+			h := &CheckRunHandler{
+				SynchronizeHandler: &PRSynchronizeHandler{PreviewDeps: PreviewDeps{Reporter: &Checks{}}},
+				CloseHandler:       &PRCloseHandler{PreviewDeps: PreviewDeps{Reporter: &Checks{}}},
+				Permissions:        tt.permissions,
+				Filter:             tt.filter,
+			}
+			event := github.CheckRunEvent{
+				Action: stringRef(tt.action),
+				CheckRun: &github.CheckRun{
+					ID:      github.Int64(7),
+					Name:    stringRef(tt.checkName),
+					HeadSHA: stringRef(tt.sha),
+				},
+				RequestedAction: &github.RequestedAction{Identifier: tt.button},
+				Repo: &github.Repository{
+					Owner: &github.User{Login: stringRef("foo")},
+					Name:  stringRef("bar"),
+				},
+				Sender: &github.User{Login: stringRef("octocat")},
+			}
+			assert.NoError(t, h.Handle(context.Background(), client, event, 10))
+			assert.Equal(t, tt.wantComments, comments)
+			assert.Len(t, created, tt.wantChecks)
+			var conclusion string
+			if len(updated) > 0 {
+				conclusion = updated[len(updated)-1].GetConclusion()
+			} else if len(created) > 0 {
+				conclusion = created[len(created)-1].GetConclusion()
+			}
+			assert.Equal(t, tt.wantConclusion, conclusion)
+		})
+	}
+}
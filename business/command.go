@@ -0,0 +1,197 @@
+package business
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"strings"
+)
+
+const (
+	CommandPrefix = "/preview"
+
+	RedeployCommand = "redeploy"
+	DestroyCommand  = "destroy"
+	StatusCommand   = "status"
+	HelpCommand     = "help"
+
+	// AckReaction is added to a comment once a command in it is picked up.
+	AckReaction = "eyes"
+)
+
+const commandHelp = "available commands:\n" +
+	"- `/preview redeploy`: rebuild the preview from the latest commit\n" +
+	"- `/preview destroy`: remove the preview\n" +
+	"- `/preview status`: show the current state of the preview\n" +
+	"- `/preview help`: show this message"
+
+// Command is a slash command found in a pull request comment.
+type Command struct {
+	Name string
+	Args []string
+}
+
+// ParseCommand returns the first slash command in a comment body. Commands
+// must start a line; a bare "/preview" is treated as a request for help.
+func ParseCommand(body string) (Command, bool) {
+	for _, line := range strings.Split(body, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || fields[0] != CommandPrefix {
+			continue
+		}
+		if len(fields) == 1 {
+			return Command{Name: HelpCommand}, true
+		}
+		return Command{Name: strings.ToLower(fields[1]), Args: fields[2:]}, true
+	}
+	return Command{}, false
+}
+
+// CommandHandler runs slash commands posted as comments on pull requests.
+type CommandHandler struct {
+	SynchronizeHandler *PRSynchronizeHandler
+	CloseHandler       *PRCloseHandler
+	// Permissions decides who may run commands. Only users with write
+	// permission are allowed when it is nil.
+	Permissions *PermissionChecker
+	URLs        *PreviewURLs
+	// Provisioner reports what is actually deployed for the status command.
+	// The status is worked out from the pull request alone when it is nil.
+	Provisioner Provisioner
+	// Filter refuses redeploys of pull requests the event filter skips, such
+	// as forks. Any open pull request can be redeployed when it is nil.
+	Filter *EventFilter
+}
+
+func (h *CommandHandler) Handle(ctx context.Context, client *github.Client, event github.IssueCommentEvent) error {
+	if event.GetAction() != "created" || !event.GetIssue().IsPullRequest() {
+		return nil
+	}
+	if event.GetSender().GetType() == "Bot" {
+		// never react to our own replies.
+		return nil
+	}
+	cmd, ok := ParseCommand(event.GetComment().GetBody())
+	if !ok {
+		return nil
+	}
+
+	repo := event.GetRepo()
+	repoOwner := repo.GetOwner().GetLogin()
+	repoName := repo.GetName()
+	prNum := event.GetIssue().GetNumber()
+	_, _, err := client.Reactions.CreateIssueCommentReaction(ctx, repoOwner, repoName, event.GetComment().GetID(), AckReaction)
+	if err != nil {
+		return err
+	}
+
+	prEvent := github.PullRequestEvent{
+		Number:       &prNum,
+		Repo:         repo,
+		Sender:       event.GetSender(),
+		Installation: event.GetInstallation(),
+	}
+	allowed, reason, err := h.permissions().Authorize(ctx, client, repoOwner, repoName, event.GetSender().GetLogin())
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return postComment(ctx, client, prEvent, "command rejected: "+reason)
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, repoOwner, repoName, prNum)
+	if err != nil {
+		return err
+	}
+	prEvent.PullRequest = pr
+	return h.run(ctx, client, cmd, prEvent)
+}
+
+func (h *CommandHandler) permissions() *PermissionChecker {
+	if h.Permissions == nil {
+		return &PermissionChecker{MinPermission: PermissionWrite}
+	}
+	return h.Permissions
+}
+
+func (h *CommandHandler) run(ctx context.Context, client *github.Client, cmd Command, event github.PullRequestEvent) error {
+	pr := event.GetPullRequest()
+	switch cmd.Name {
+	case RedeployCommand:
+		if reason := previewBlocked(pr); reason != "" {
+			return postComment(ctx, client, event, "cannot redeploy: "+reason)
+		}
+		if reason := filterRedeploy(h.Filter, event); reason != "" {
+			return postComment(ctx, client, event, "cannot redeploy: "+reason)
+		}
+		return h.SynchronizeHandler.Handle(ctx, client, event)
+	case DestroyCommand:
+		if pr.GetState() == "closed" {
+			return postComment(ctx, client, event, "cannot destroy: this pull request is closed and its site is already cleaned up")
+		}
+		return h.CloseHandler.Handle(ctx, client, event)
+	case StatusCommand:
+		msg, err := h.status(ctx, client, event)
+		if err != nil {
+			return err
+		}
+		return postComment(ctx, client, event, msg)
+	case HelpCommand:
+		return postComment(ctx, client, event, commandHelp)
+	}
+	msg := fmt.Sprintf("unknown command `%s %s`\n\n%s", CommandPrefix, cmd.Name, commandHelp)
+	return postComment(ctx, client, event, msg)
+}
+
+// filterRedeploy explains why filter skips the pull request of event, or
+// returns an empty string when it may be redeployed.
+func filterRedeploy(filter *EventFilter, event github.PullRequestEvent) string {
+	if filter == nil {
+		return ""
+	}
+	if reason := filter.Check(event); reason != "" {
+		return fmt.Sprintf("previews skip this pull request (%s)", reason)
+	}
+	return ""
+}
+
+// previewBlocked explains why a pull request has no preview, or returns an
+// empty string when it should have one.
+func previewBlocked(pr *github.PullRequest) string {
+	switch {
+	case pr.GetState() == "closed":
+		return "this pull request is closed"
+	case pr.GetDraft():
+		return "previews are deferred while this pull request is a draft"
+	case hasLabel(pr, NoPreviewLabel):
+		return "previews are disabled by the " + NoPreviewLabel + " label"
+	}
+	return ""
+}
+
+func (h *CommandHandler) status(ctx context.Context, client *github.Client, event github.PullRequestEvent) (string, error) {
+	pr := event.GetPullRequest()
+	previewURL := h.URLs.URL(event)
+	if h.Provisioner == nil || previewBlocked(pr) != "" {
+		return previewStatus(pr, previewURL), nil
+	}
+	state, ok, err := h.Provisioner.Status(ctx, client, newPreview(event, previewURL))
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "no preview: it has not been deployed yet", nil
+	}
+	msg := fmt.Sprintf("preview for %s is live at: %s", shortSHA(state.HeadSHA), state.URL)
+	if state.HeadSHA != pr.GetHead().GetSHA() {
+		msg += fmt.Sprintf("\n\nthe latest commit %s is not deployed yet", shortSHA(pr.GetHead().GetSHA()))
+	}
+	return msg, nil
+}
+
+func previewStatus(pr *github.PullRequest, previewURL string) string {
+	if reason := previewBlocked(pr); reason != "" {
+		return "no preview: " + reason
+	}
+	return fmt.Sprintf("preview for %s is live at: %s", shortSHA(pr.GetHead().GetSHA()), previewURL)
+}
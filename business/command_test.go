@@ -0,0 +1,298 @@
+package business
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/go-github/v47/github"
+	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func mockedCommandClient(pr github.PullRequest, role string) *github.Client {
+	return github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatch(
+			mock.PostReposIssuesCommentsReactionsByOwnerByRepoByCommentId,
+			github.Reaction{Content: stringRef(AckReaction)},
+		),
+		mock.WithRequestMatch(
+			mock.GetReposCollaboratorsPermissionByOwnerByRepoByUsername,
+			collaboratorPermission{Permission: role, RoleName: role},
+		),
+		mock.WithRequestMatch(mock.GetReposPullsByOwnerByRepoByPullNumber, pr),
+		mock.WithRequestMatch(mock.GetReposIssuesCommentsByOwnerByRepoByIssueNumber, []github.IssueComment{}),
+		mock.WithRequestMatch(mock.PostReposIssuesCommentsByOwnerByRepoByIssueNumber, github.IssueComment{}),
+	))
+}
+
+func mockedCommandErrorClient() *github.Client {
+	return github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatchHandler(
+			mock.PostReposIssuesCommentsReactionsByOwnerByRepoByCommentId,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mock.WriteError(w, http.StatusInternalServerError, "github fail whale")
+			}),
+		),
+	))
+}
+
+func testIssueCommentEvent(body string) github.IssueCommentEvent {
+	return github.IssueCommentEvent{
+		Action: stringRef("created"),
+		Issue: &github.Issue{
+			Number:           intRef(10),
+			PullRequestLinks: &github.PullRequestLinks{URL: stringRef("https://example.com/pulls/10")},
+		},
+		Comment: &github.IssueComment{ID: github.Int64(1), Body: stringRef(body)},
+		Repo: &github.Repository{
+			Owner: &github.User{Login: stringRef("foo")},
+			Name:  stringRef("bar"),
+		},
+		Sender: &github.User{Login: stringRef("octocat"), Type: stringRef("User")},
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		want   Command
+		wantOk bool
+	}{
+		{
+			name:   "redeploy",
+			body:   "/preview redeploy",
+			want:   Command{Name: RedeployCommand, Args: []string{}},
+			wantOk: true,
+		},
+		{
+			name:   "command after text with arguments",
+			body:   "looks good\n/preview Status now please",
+			want:   Command{Name: StatusCommand, Args: []string{"now", "please"}},
+			wantOk: true,
+		},
+		{
+			name:   "bare prefix",
+			body:   "/preview",
+			want:   Command{Name: HelpCommand},
+			wantOk: true,
+		},
+		{
+			name:   "mentioned inline",
+			body:   "try `/preview redeploy` maybe",
+			wantOk: false,
+		},
+		{
+			name:   "other prefix",
+			body:   "/previews destroy",
+			wantOk: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseCommand(tt.body)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCommandHandler_Handle(t *testing.T) {
+	openPR := github.PullRequest{
+		Number: intRef(10),
+		State:  stringRef("open"),
+		Head:   &github.PullRequestBranch{SHA: stringRef("0123456789abcdef")},
+	}
+	draftPR := openPR
+	draftPR.Draft = boolRef(true)
+	fromBot := testIssueCommentEvent("/preview redeploy")
+	fromBot.Sender.Type = stringRef("Bot")
+	onIssue := testIssueCommentEvent("/preview redeploy")
+	onIssue.Issue.PullRequestLinks = nil
+	edited := testIssueCommentEvent("/preview redeploy")
+	edited.Action = stringRef("edited")
+	type args struct {
+		ctx    context.Context
+		client *github.Client
+		event  github.IssueCommentEvent
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "redeploy",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedCommandClient(openPR, "write"),
+				event:  testIssueCommentEvent("/preview redeploy"),
+			},
+		},
+		{
+			name: "redeploy draft",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedCommandClient(draftPR, "write"),
+				event:  testIssueCommentEvent("/preview redeploy"),
+			},
+		},
+		{
+			name: "destroy",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedCommandClient(openPR, "write"),
+				event:  testIssueCommentEvent("/preview destroy"),
+			},
+		},
+		{
+			name: "status",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedCommandClient(openPR, "write"),
+				event:  testIssueCommentEvent("/preview status"),
+			},
+		},
+		{
+			name: "unknown command",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedCommandClient(openPR, "write"),
+				event:  testIssueCommentEvent("/preview launch"),
+			},
+		},
+		{
+			name: "not a command",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedCommandErrorClient(),
+				event:  testIssueCommentEvent("nice work"),
+			},
+		},
+		{
+			name: "bot sender is ignored",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedCommandErrorClient(),
+				event:  fromBot,
+			},
+		},
+		{
+			name: "issue comment is ignored",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedCommandErrorClient(),
+				event:  onIssue,
+			},
+		},
+		{
+			name: "edited comment is ignored",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedCommandErrorClient(),
+				event:  edited,
+			},
+		},
+		{
+			name: "github client error",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedCommandErrorClient(),
+				event:  testIssueCommentEvent("/preview status"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &CommandHandler{
+				SynchronizeHandler: &PRSynchronizeHandler{},
+				CloseHandler:       &PRCloseHandler{},
+			}
+			if err := h.Handle(tt.args.ctx, tt.args.client, tt.args.event); (err != nil) != tt.wantErr {
+				t.Errorf("Handle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCommandHandler_redeployFiltered(t *testing.T) {
+	fork := github.PullRequest{
+		Number: intRef(10),
+		State:  stringRef("open"),
+		Head: &github.PullRequestBranch{
+			SHA:  stringRef("0123456789abcdef"),
+			Repo: &github.Repository{Fork: boolRef(true)},
+		},
+	}
+	var replies []string
+	client := github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatch(
+			mock.PostReposIssuesCommentsReactionsByOwnerByRepoByCommentId,
+			github.Reaction{Content: stringRef(AckReaction)},
+		),
+		mock.WithRequestMatch(
+			mock.GetReposCollaboratorsPermissionByOwnerByRepoByUsername,
+			collaboratorPermission{Permission: "write", RoleName: "write"},
+		),
+		mock.WithRequestMatch(mock.GetReposPullsByOwnerByRepoByPullNumber, fork),
+		mock.WithRequestMatchHandler(mock.GetReposIssuesCommentsByOwnerByRepoByIssueNumber, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("unexpected preview update")
+			w.WriteHeader(http.StatusForbidden)
+		})),
+		mock.WithRequestMatchHandler(mock.PostReposIssuesCommentsByOwnerByRepoByIssueNumber, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var c github.IssueComment
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&c))
+			replies = append(replies, c.GetBody())
+			w.Write(mock.MustMarshal(c))
+		})),
+	))
+	h := &CommandHandler{
+		SynchronizeHandler: &PRSynchronizeHandler{},
+		CloseHandler:       &PRCloseHandler{},
+		Filter:             &EventFilter{SkipForks: true, Registry: metrics.NewRegistry()},
+	}
+	assert.NoError(t, h.Handle(context.Background(), client, testIssueCommentEvent("/preview redeploy")))
+	if assert.Len(t, replies, 1) {
+		assert.Contains(t, replies[0], "cannot redeploy")
+		assert.Contains(t, replies[0], SkipReasonFork)
+	}
+}
+
+func TestCommandHandler_rejected(t *testing.T) {
+	var replies []string
+	unexpected := func(what string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			t.Error("unexpected " + what)
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}
+	client := github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatch(
+			mock.PostReposIssuesCommentsReactionsByOwnerByRepoByCommentId,
+			github.Reaction{Content: stringRef(AckReaction)},
+		),
+		mock.WithRequestMatch(
+			mock.GetReposCollaboratorsPermissionByOwnerByRepoByUsername,
+			collaboratorPermission{Permission: "read", RoleName: "read"},
+		),
+		mock.WithRequestMatchHandler(mock.GetReposPullsByOwnerByRepoByPullNumber, unexpected("pull request fetch")),
+		mock.WithRequestMatchHandler(mock.GetReposIssuesCommentsByOwnerByRepoByIssueNumber, unexpected("preview update")),
+		mock.WithRequestMatchHandler(mock.PostReposIssuesCommentsByOwnerByRepoByIssueNumber, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var c github.IssueComment
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&c))
+			replies = append(replies, c.GetBody())
+			w.Write(mock.MustMarshal(c))
+		})),
+	))
+	h := &CommandHandler{
+		SynchronizeHandler: &PRSynchronizeHandler{},
+		CloseHandler:       &PRCloseHandler{PreviewDeps: PreviewDeps{Provisioner: NewMemoryProvisioner()}},
+	}
+	assert.NoError(t, h.Handle(context.Background(), client, testIssueCommentEvent("/preview destroy")))
+	if assert.Len(t, replies, 1) {
+		assert.Contains(t, replies[0], "command rejected")
+	}
+}
@@ -0,0 +1,55 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+)
+
+const (
+	// NoPreviewLabel disables previews for a pull request while it is applied.
+	NoPreviewLabel = "no-preview"
+
+	previewURL = "http://example.com/site"
+)
+
+// postComment posts msg as a new comment on the pull request the event refers
+// to, for replies that are not part of the preview state.
+func postComment(ctx context.Context, client *github.Client, event github.PullRequestEvent, msg string) error {
+	repo := event.GetRepo()
+	repoName := repo.GetName()
+	prNum := event.GetNumber()
+	repoOwner := repo.GetOwner().GetLogin()
+	comment := &github.IssueComment{
+		Body: &msg,
+	}
+	_, _, err := client.Issues.CreateComment(ctx, repoOwner, repoName, prNum, comment)
+	return err
+}
+
+// hasLabel reports whether the pull request carries the named label.
+func hasLabel(pr *github.PullRequest, name string) bool {
+	if pr == nil {
+		return false
+	}
+	for _, label := range pr.Labels {
+		if label.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// previewEnabled reports whether the pull request should have a live preview.
+// Closed pull requests get none, and drafts and pull requests labeled with
+// NoPreviewLabel are deferred.
+func previewEnabled(pr *github.PullRequest) bool {
+	return previewBlocked(pr) == ""
+}
+
+// shortSHA returns the abbreviated form of a commit SHA used in messages.
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
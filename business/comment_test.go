@@ -0,0 +1,68 @@
+package business
+
+import (
+	"github.com/google/go-github/v47/github"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func testPullRequestEvent(action string) github.PullRequestEvent {
+	return github.PullRequestEvent{
+		Action: stringRef(action),
+		Number: intRef(10),
+		Repo: &github.Repository{
+			Owner: &github.User{Login: stringRef("foo")},
+			Name:  stringRef("bar"),
+		},
+		PullRequest: &github.PullRequest{
+			Number: intRef(10),
+			Head: &github.PullRequestBranch{
+				Ref: stringRef("feature"),
+				SHA: stringRef("0123456789abcdef"),
+			},
+			Base: &github.PullRequestBranch{
+				Ref: stringRef("main"),
+			},
+		},
+	}
+}
+
+func boolRef(b bool) *bool {
+	return &b
+}
+
+func Test_previewEnabled(t *testing.T) {
+	tests := []struct {
+		name string
+		pr   *github.PullRequest
+		want bool
+	}{
+		{
+			name: "ready pull request",
+			pr:   &github.PullRequest{},
+			want: true,
+		},
+		{
+			name: "draft pull request",
+			pr:   &github.PullRequest{Draft: boolRef(true)},
+			want: false,
+		},
+		{
+			name: "labeled with no-preview",
+			pr: &github.PullRequest{
+				Labels: []*github.Label{{Name: stringRef("bug")}, {Name: stringRef(NoPreviewLabel)}},
+			},
+			want: false,
+		},
+		{
+			name: "nil pull request",
+			pr:   nil,
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, previewEnabled(tt.pr))
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package business
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"github.com/rs/zerolog"
+)
+
+// Deployment status states reported for previews.
+const (
+	DeploymentInProgress = "in_progress"
+	DeploymentSuccess    = "success"
+	DeploymentFailure    = "failure"
+	DeploymentInactive   = "inactive"
+)
+
+// maxStatusDescription is the longest description GitHub accepts on a
+// deployment or commit status.
+const maxStatusDescription = 140
+
+// PreviewEnvironment names the GitHub environment of a pull request's preview.
+func PreviewEnvironment(number int) string {
+	return fmt.Sprintf("preview/pr-%d", number)
+}
+
+// Deployments reports previews as GitHub deployments of the pull request
+// head, so they show up behind the pull request's "View deployment" button
+// and on the repository's environments page. A nil Deployments reports
+// nothing.
+type Deployments struct {
+	// Permissions limits deployments to installations granting the app
+	// deployments: write. Every installation is assumed to when it is nil.
+	Permissions InstallationPermissions
+}
+
+// granted reports whether the event's installation lets the app create
+// deployments.
+func (d *Deployments) granted(ctx context.Context, event github.PullRequestEvent) (bool, error) {
+	if d == nil {
+		return false, nil
+	}
+	if d.Permissions == nil {
+		return true, nil
+	}
+	perms, err := d.Permissions.Permissions(ctx, event.GetInstallation().GetID())
+	if err != nil {
+		return false, err
+	}
+	if perms.GetDeployments() != "write" {
+		zerolog.Ctx(ctx).Debug().Msg("installation does not grant deployments, not reporting the preview as one")
+		return false, nil
+	}
+	return true, nil
+}
+
+// Start creates a deployment of the pull request head and marks it in
+// progress.
+func (d *Deployments) Start(ctx context.Context, client *github.Client, event github.PullRequestEvent) (*PreviewDeployment, error) {
+	if ok, err := d.granted(ctx, event); !ok {
+		return nil, err
+	}
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	deployment, _, err := client.Repositories.CreateDeployment(ctx, owner, repo, &github.DeploymentRequest{
+		Ref:         github.String(event.GetPullRequest().GetHead().GetSHA()),
+		Environment: github.String(PreviewEnvironment(event.GetNumber())),
+		Description: github.String(fmt.Sprintf("Preview of pull request #%d", event.GetNumber())),
+		// previews are built from the head commit as is, whatever its checks
+		// say.
+		AutoMerge:             github.Bool(false),
+		RequiredContexts:      &[]string{},
+		TransientEnvironment:  github.Bool(true),
+		ProductionEnvironment: github.Bool(false),
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := &PreviewDeployment{client: client, owner: owner, repo: repo, id: deployment.GetID()}
+	if err := p.setStatus(ctx, DeploymentInProgress, "Deploying preview", ""); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Deactivate marks the deployments to the pull request's preview environment
+// inactive once the preview is gone. Deployments already inactive are left
+// alone, as GitHub does not deactivate older deployments to transient
+// environments by itself.
+func (d *Deployments) Deactivate(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	if ok, err := d.granted(ctx, event); !ok {
+		return err
+	}
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	active, err := d.active(ctx, client, owner, repo, event.GetNumber())
+	if err != nil {
+		return err
+	}
+	// oldest first, so that an inactive deployment is never newer than an
+	// active one, even when this fails part way.
+	for i := len(active) - 1; i >= 0; i-- {
+		p := &PreviewDeployment{client: client, owner: owner, repo: repo, id: active[i]}
+		if err := p.setStatus(ctx, DeploymentInactive, "Preview cleaned up", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// active lists the deployments of the pull request's preview that are newer
+// than its newest inactive one, newest first. Older ones were deactivated
+// when that one was.
+func (d *Deployments) active(ctx context.Context, client *github.Client, owner, repo string, number int) ([]int64, error) {
+	var ids []int64
+	opts := &github.DeploymentsListOptions{
+		Environment: PreviewEnvironment(number),
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		deployments, resp, err := client.Repositories.ListDeployments(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, deployment := range deployments {
+			statuses, _, err := client.Repositories.ListDeploymentStatuses(ctx, owner, repo, deployment.GetID(), &github.ListOptions{PerPage: 1})
+			if err != nil {
+				return nil, err
+			}
+			if len(statuses) > 0 && statuses[0].GetState() == DeploymentInactive {
+				return ids, nil
+			}
+			ids = append(ids, deployment.GetID())
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return ids, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// PreviewDeployment is a deployment created by Start. A nil
+// PreviewDeployment reports nothing.
+type PreviewDeployment struct {
+	client *github.Client
+	owner  string
+	repo   string
+	id     int64
+}
+
+// Succeed marks the deployment live at previewURL. GitHub marks earlier
+// deployments to the same environment inactive.
+func (p *PreviewDeployment) Succeed(ctx context.Context, previewURL string) error {
+	if p == nil {
+		return nil
+	}
+	return p.setStatus(ctx, DeploymentSuccess, "Preview is live", previewURL)
+}
+
+// Fail marks the deployment failed and returns cause. Failing to report the
+// failure is only logged, so cause is what gets retried or reported.
+func (p *PreviewDeployment) Fail(ctx context.Context, cause error) error {
+	if p == nil {
+		return cause
+	}
+	if err := p.setStatus(ctx, DeploymentFailure, cause.Error(), ""); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Int64("deployment", p.id).Msg("failed to report deployment failure")
+	}
+	return cause
+}
+
+func (p *PreviewDeployment) setStatus(ctx context.Context, state, description, environmentURL string) error {
+	status := &github.DeploymentStatusRequest{
+		State:       github.String(state),
+		Description: github.String(truncateDescription(description)),
+	}
+	if environmentURL != "" {
+		status.EnvironmentURL = github.String(environmentURL)
+	}
+	_, _, err := p.client.Repositories.CreateDeploymentStatus(ctx, p.owner, p.repo, p.id, status)
+	return err
+}
+
+func truncateDescription(description string) string {
+	if len(description) <= maxStatusDescription {
+		return description
+	}
+	return description[:maxStatusDescription-3] + "..."
+}
+
+// publishPreview deploys the preview of the pull request head, live at
+// previewURL, reports it as a deployment and through reporter, and shows msg
+// in the preview comment. Deployments are extras, so failing to report one
+// is only logged.
+func publishPreview(ctx context.Context, client *github.Client, provisioner Provisioner, deployments *Deployments, reporter Reporter, event github.PullRequestEvent, previewURL, msg string) error {
+	deployment, err := deployments.Start(ctx, client, event)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("failed to start preview deployment")
+	}
+	report, err := startReport(ctx, client, reporter, event)
+	if err != nil {
+		return deployment.Fail(ctx, err)
+	}
+	if provisioner != nil {
+		if err := provisioner.Deploy(ctx, client, newPreview(event, previewURL)); err != nil {
+			return deployment.Fail(ctx, report.Fail(ctx, err))
+		}
+	}
+	if err := updatePreviewComment(ctx, client, event, msg); err != nil {
+		return deployment.Fail(ctx, report.Fail(ctx, err))
+	}
+	if err := deployment.Succeed(ctx, previewURL); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("failed to report preview deployment")
+	}
+	return report.Succeed(ctx, previewURL)
+}
+
+// retirePreview destroys the preview served at previewURL, marks the pull
+// request's deployments inactive, retires its check or status and shows msg
+// in the preview comment.
+func retirePreview(ctx context.Context, client *github.Client, provisioner Provisioner, deployments *Deployments, reporter Reporter, event github.PullRequestEvent, previewURL, msg string) error {
+	if provisioner != nil {
+		if err := provisioner.Destroy(ctx, client, newPreview(event, previewURL)); err != nil {
+			return err
+		}
+	}
+	if err := deployments.Deactivate(ctx, client, event); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("failed to deactivate preview deployments")
+	}
+	if err := retireReport(ctx, client, reporter, event); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("failed to retire preview report")
+	}
+	return updatePreviewComment(ctx, client, event, msg)
+}
@@ -0,0 +1,189 @@
+package business
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/go-github/v47/github"
+	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// deploymentClient records the deployments created and the statuses posted,
+// failing comments when commentErr is set. latest holds the latest status of
+// the listed deployments, which have none when it is missing.
+func deploymentClient(t *testing.T, created *[]github.DeploymentRequest, statuses *[]github.DeploymentStatusRequest, commentErr bool, latest map[int64]string, pages ...[]*github.Deployment) *github.Client {
+	decode := func(r *http.Request, v interface{}) {
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(b, v))
+	}
+	listed := make([]interface{}, len(pages))
+	for i, p := range pages {
+		listed[i] = p
+	}
+	return github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatchHandler(mock.PostReposDeploymentsByOwnerByRepo, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var d github.DeploymentRequest
+			decode(r, &d)
+			*created = append(*created, d)
+			w.Write(mock.MustMarshal(github.Deployment{ID: github.Int64(42)}))
+		})),
+		mock.WithRequestMatchHandler(mock.PostReposDeploymentsStatusesByOwnerByRepoByDeploymentId, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var s github.DeploymentStatusRequest
+			decode(r, &s)
+			*statuses = append(*statuses, s)
+			w.Write(mock.MustMarshal(github.DeploymentStatus{State: s.State}))
+		})),
+		mock.WithRequestMatchPages(mock.GetReposDeploymentsByOwnerByRepo, listed...),
+		mock.WithRequestMatchHandler(mock.GetReposDeploymentsStatusesByOwnerByRepoByDeploymentId, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the path ends in /deployments/{id}/statuses.
+			parts := strings.Split(r.URL.Path, "/")
+			id, err := strconv.ParseInt(parts[len(parts)-2], 10, 64)
+			assert.NoError(t, err)
+			var listed []github.DeploymentStatus
+			if state, ok := latest[id]; ok {
+				listed = append(listed, github.DeploymentStatus{State: github.String(state)})
+			}
+			w.Write(mock.MustMarshal(listed))
+		})),
+		mock.WithRequestMatch(mock.GetReposIssuesCommentsByOwnerByRepoByIssueNumber, []github.IssueComment{}),
+		mock.WithRequestMatchHandler(mock.PostReposIssuesCommentsByOwnerByRepoByIssueNumber, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if commentErr {
+				// a raw error body, since the mock's errors cannot be printed.
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(`{"message":"github fail whale"}`))
+				return
+			}
+			w.Write(mock.MustMarshal(github.IssueComment{}))
+		})),
+	))
+}
+
+func statusStates(statuses []github.DeploymentStatusRequest) []string {
+	states := make([]string, len(statuses))
+	for i, s := range statuses {
+		states[i] = s.GetState()
+	}
+	return states
+}
+
+func TestPublishPreview(t *testing.T) {
+	tests := []struct {
+		name        string
+		deployments *Deployments
+		commentErr  bool
+		wantErr     bool
+		wantCreated int
+		wantStates  []string
+	}{
+		{
+			name:        "live preview",
+			deployments: &Deployments{},
+			wantCreated: 1,
+			wantStates:  []string{DeploymentInProgress, DeploymentSuccess},
+		},
+		{
+			name:        "failed preview",
+			deployments: &Deployments{},
+			commentErr:  true,
+			wantErr:     true,
+			wantCreated: 1,
+			wantStates:  []string{DeploymentInProgress, DeploymentFailure},
+		},
+		{
+			name:        "granted deployments",
+			deployments: &Deployments{Permissions: fakePermissions{permissions: &github.InstallationPermissions{Deployments: stringRef("write")}}},
+			wantCreated: 1,
+			wantStates:  []string{DeploymentInProgress, DeploymentSuccess},
+		},
+		{
+			name:        "deployments not granted",
+			deployments: &Deployments{Permissions: fakePermissions{permissions: &github.InstallationPermissions{Statuses: stringRef("write")}}},
+			wantStates:  []string{},
+		},
+		{
+			name:        "deployment cannot start",
+			deployments: &Deployments{Permissions: fakePermissions{err: errors.New("bad credentials")}},
+			wantStates:  []string{},
+		},
+		{
+			name:       "comment only",
+			wantStates: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []github.DeploymentRequest
+			var statuses []github.DeploymentStatusRequest
+			client := deploymentClient(t, &created, &statuses, tt.commentErr, nil)
+			event := stickyEvent("0123456789abcdef")
+			err := publishPreview(context.Background(), client, nil, tt.deployments, nil, event, "https://pr-10.example.com", "preview your site")
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Len(t, created, tt.wantCreated)
+			assert.Equal(t, tt.wantStates, statusStates(statuses))
+			if tt.wantCreated > 0 {
+				assert.Equal(t, "0123456789abcdef", created[0].GetRef())
+				assert.Equal(t, "preview/pr-10", created[0].GetEnvironment())
+				assert.True(t, created[0].GetTransientEnvironment())
+			}
+			if !tt.wantErr && len(statuses) > 0 {
+				assert.Equal(t, "https://pr-10.example.com", statuses[len(statuses)-1].GetEnvironmentURL())
+			}
+		})
+	}
+}
+
+func TestDeployments_Deactivate(t *testing.T) {
+	var created []github.DeploymentRequest
+	var statuses []github.DeploymentStatusRequest
+	client := deploymentClient(t, &created, &statuses, false, nil,
+		[]*github.Deployment{{ID: github.Int64(1)}, {ID: github.Int64(2)}},
+		[]*github.Deployment{{ID: github.Int64(3)}},
+	)
+	event := stickyEvent("0123456789abcdef")
+	err := retirePreview(context.Background(), client, nil, &Deployments{}, nil, event, "https://pr-10.example.com", "your site has been cleaned up")
+	assert.NoError(t, err)
+	assert.Empty(t, created)
+	assert.Equal(t, []string{DeploymentInactive, DeploymentInactive, DeploymentInactive}, statusStates(statuses))
+}
+
+func TestDeployments_DeactivateSkipsInactive(t *testing.T) {
+	var created []github.DeploymentRequest
+	var statuses []github.DeploymentStatusRequest
+	latest := map[int64]string{5: DeploymentSuccess, 4: DeploymentFailure, 3: DeploymentInactive}
+	// deployment 2 is older than an inactive one and left alone.
+	client := deploymentClient(t, &created, &statuses, false, latest,
+		[]*github.Deployment{{ID: github.Int64(5)}, {ID: github.Int64(4)}, {ID: github.Int64(3)}, {ID: github.Int64(2)}},
+	)
+	deployments := &Deployments{}
+	assert.NoError(t, deployments.Deactivate(context.Background(), client, stickyEvent("0123456789abcdef")))
+	assert.Equal(t, []string{DeploymentInactive, DeploymentInactive}, statusStates(statuses))
+}
+
+func TestDeployments_DeactivateNotGranted(t *testing.T) {
+	var created []github.DeploymentRequest
+	var statuses []github.DeploymentStatusRequest
+	client := deploymentClient(t, &created, &statuses, false, nil)
+	deployments := &Deployments{Permissions: fakePermissions{permissions: &github.InstallationPermissions{}}}
+	event := stickyEvent("0123456789abcdef")
+	err := retirePreview(context.Background(), client, nil, deployments, nil, event, "https://pr-10.example.com", "your site has been cleaned up")
+	assert.NoError(t, err)
+	assert.Empty(t, statuses)
+}
+
+func TestPreviewDeployment_FailTruncates(t *testing.T) {
+	var created []github.DeploymentRequest
+	var statuses []github.DeploymentStatusRequest
+	client := deploymentClient(t, &created, &statuses, false, nil)
+	p := &PreviewDeployment{client: client, owner: "foo", repo: "bar", id: 42}
+	cause := errors.New(strings.Repeat("x", 500))
+	assert.Equal(t, cause, p.Fail(context.Background(), cause))
+	assert.Equal(t, []string{DeploymentFailure}, statusStates(statuses))
+	assert.Len(t, statuses[0].GetDescription(), maxStatusDescription)
+}
@@ -0,0 +1,94 @@
+package business
+
+import (
+	"errors"
+	"github.com/google/go-github/v47/github"
+	"net/http"
+)
+
+// ErrorKind tells callers what to do with an error returned by a handler.
+type ErrorKind int
+
+const (
+	// RetryableError is a transient failure; the delivery should be retried.
+	RetryableError ErrorKind = iota
+	// PermanentError will fail the same way on every attempt.
+	PermanentError
+	// IgnoredError means the event was deliberately not processed.
+	IgnoredError
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case PermanentError:
+		return "permanent"
+	case IgnoredError:
+		return "ignored"
+	}
+	return "retryable"
+}
+
+type classifiedError struct {
+	kind ErrorKind
+	err  error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// Retryable marks err as a transient failure.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{kind: RetryableError, err: err}
+}
+
+// Permanent marks err as a failure that retrying cannot fix.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{kind: PermanentError, err: err}
+}
+
+// Ignored marks err as a reason the event was skipped rather than a failure.
+func Ignored(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{kind: IgnoredError, err: err}
+}
+
+// Classify returns the kind of err. Errors marked with Retryable, Permanent
+// or Ignored keep their mark; GitHub API errors are classified by status
+// code, and anything else is assumed to be retryable.
+func Classify(err error) ErrorKind {
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.kind
+	}
+	var rateLimit *github.RateLimitError
+	var abuse *github.AbuseRateLimitError
+	if errors.As(err, &rateLimit) || errors.As(err, &abuse) {
+		return RetryableError
+	}
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil {
+		switch code := errResp.Response.StatusCode; {
+		case code == http.StatusNotFound,
+			code == http.StatusGone,
+			code == http.StatusUnprocessableEntity,
+			code == http.StatusUnauthorized,
+			code == http.StatusForbidden,
+			code == http.StatusBadRequest:
+			return PermanentError
+		}
+	}
+	return RetryableError
+}
@@ -0,0 +1,48 @@
+package business
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func githubError(code int) error {
+	return &github.ErrorResponse{Response: &http.Response{StatusCode: code}, Message: http.StatusText(code)}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorKind
+	}{
+		{name: "plain error", err: errors.New("boom"), want: RetryableError},
+		{name: "marked permanent", err: Permanent(errors.New("bad payload")), want: PermanentError},
+		{name: "wrapped mark", err: fmt.Errorf("handling: %w", Ignored(errors.New("draft"))), want: IgnoredError},
+		{name: "mark overrides status", err: Retryable(githubError(http.StatusNotFound)), want: RetryableError},
+		{name: "deleted repository", err: githubError(http.StatusNotFound), want: PermanentError},
+		{name: "validation failed", err: githubError(http.StatusUnprocessableEntity), want: PermanentError},
+		{name: "server error", err: githubError(http.StatusBadGateway), want: RetryableError},
+		{name: "rate limited", err: &github.RateLimitError{Response: &http.Response{StatusCode: http.StatusForbidden}}, want: RetryableError},
+		{name: "secondary rate limit", err: &github.AbuseRateLimitError{Response: &http.Response{StatusCode: http.StatusForbidden}}, want: RetryableError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Classify(tt.err))
+		})
+	}
+}
+
+func TestClassifiedError(t *testing.T) {
+	inner := errors.New("inner")
+	err := Permanent(inner)
+	assert.Equal(t, "inner", err.Error())
+	assert.ErrorIs(t, err, inner)
+	assert.Nil(t, Permanent(nil))
+	assert.Nil(t, Retryable(nil))
+	assert.Nil(t, Ignored(nil))
+	assert.Equal(t, "ignored", IgnoredError.String())
+}
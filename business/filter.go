@@ -0,0 +1,114 @@
+package business
+
+import (
+	"github.com/google/go-github/v47/github"
+	"github.com/rcrowley/go-metrics"
+	"strings"
+)
+
+const (
+	SkipReasonBot         = "bot"
+	SkipReasonFork        = "fork"
+	SkipReasonDraft       = "draft"
+	SkipReasonBaseBranch  = "base_branch"
+	SkipReasonLabel       = "label"
+	SkipReasonTitleMarker = "title_marker"
+
+	// MetricsKeySkippedEvents prefixes the per-reason counters of skipped
+	// events.
+	MetricsKeySkippedEvents = "preview.events.skipped"
+)
+
+// teardownActions may remove a preview. The base branch, draft, label and
+// title rules, and the bot rule for their sender, do not apply to them, so a
+// preview created before a rule matched is still cleaned up when the pull
+// request is closed, drafted or labeled no-preview. A rule that starts to
+// match does not remove the preview by itself.
+var teardownActions = map[string]bool{
+	"closed":             true,
+	"converted_to_draft": true,
+	"labeled":            true,
+}
+
+// EventFilter decides which pull request events reach the business
+// handlers.
+type EventFilter struct {
+	// SkipBots skips events sent by bots or on pull requests opened by bots,
+	// such as Dependabot.
+	SkipBots bool
+	// SkipForks skips pull requests from forked repositories.
+	SkipForks bool
+	// SkipDrafts skips draft pull requests.
+	SkipDrafts bool
+	// SkipBaseBranches skips pull requests targeting these branches.
+	SkipBaseBranches []string
+	// SkipLabels skips pull requests carrying any of these labels.
+	SkipLabels []string
+	// SkipTitleMarker skips pull requests whose title contains it, such as
+	// "[skip preview]". Matching ignores case.
+	SkipTitleMarker string
+	// Registry receives a counter per skip reason. The default registry is
+	// used when it is nil.
+	Registry metrics.Registry
+}
+
+// Check returns why the event should be skipped, or an empty string when it
+// should be processed. Skipped events are counted by reason.
+func (f *EventFilter) Check(event github.PullRequestEvent) string {
+	reason := f.reason(event)
+	if reason != "" {
+		registry := f.Registry
+		if registry == nil {
+			registry = metrics.DefaultRegistry
+		}
+		metrics.GetOrRegisterCounter(MetricsKeySkippedEvents+"."+reason, registry).Inc(1)
+	}
+	return reason
+}
+
+func (f *EventFilter) reason(event github.PullRequestEvent) string {
+	pr := event.GetPullRequest()
+	teardown := teardownActions[event.GetAction()]
+	switch {
+	case f.SkipBots && pr.GetUser().GetType() == "Bot":
+		return SkipReasonBot
+	// bots merging or closing pull requests opened by people still tear
+	// their previews down.
+	case f.SkipBots && !teardown && event.GetSender().GetType() == "Bot":
+		return SkipReasonBot
+	case f.SkipForks && pr.GetHead().GetRepo().GetFork():
+		return SkipReasonFork
+	}
+	if teardown {
+		return ""
+	}
+	switch {
+	case contains(f.SkipBaseBranches, pr.GetBase().GetRef()):
+		return SkipReasonBaseBranch
+	case f.SkipDrafts && pr.GetDraft():
+		return SkipReasonDraft
+	case f.hasSkipLabel(pr):
+		return SkipReasonLabel
+	case f.SkipTitleMarker != "" && strings.Contains(strings.ToLower(pr.GetTitle()), strings.ToLower(f.SkipTitleMarker)):
+		return SkipReasonTitleMarker
+	}
+	return ""
+}
+
+func (f *EventFilter) hasSkipLabel(pr *github.PullRequest) bool {
+	for _, label := range f.SkipLabels {
+		if hasLabel(pr, label) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
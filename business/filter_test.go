@@ -0,0 +1,71 @@
+package business
+
+import (
+	"github.com/google/go-github/v47/github"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEventFilter_Check(t *testing.T) {
+	filter := EventFilter{
+		SkipBots:         true,
+		SkipForks:        true,
+		SkipDrafts:       true,
+		SkipBaseBranches: []string{"gh-pages"},
+		SkipLabels:       []string{"dependencies"},
+		SkipTitleMarker:  "[skip preview]",
+	}
+	botSender := testPullRequestEvent("opened")
+	botSender.Sender = &github.User{Login: stringRef("dependabot[bot]"), Type: stringRef("Bot")}
+	botCloser := testPullRequestEvent("closed")
+	botCloser.Sender = &github.User{Login: stringRef("mergify[bot]"), Type: stringRef("Bot")}
+	botAuthor := testPullRequestEvent("closed")
+	botAuthor.PullRequest.User = &github.User{Login: stringRef("dependabot[bot]"), Type: stringRef("Bot")}
+	fork := testPullRequestEvent("synchronize")
+	fork.PullRequest.Head.Repo = &github.Repository{Fork: boolRef(true)}
+	pages := testPullRequestEvent("opened")
+	pages.PullRequest.Base.Ref = stringRef("gh-pages")
+	pagesClose := testPullRequestEvent("closed")
+	pagesClose.PullRequest.Base.Ref = stringRef("gh-pages")
+	titled := testPullRequestEvent("opened")
+	titled.PullRequest.Title = stringRef("Fix typo [Skip Preview]")
+	titledClose := testPullRequestEvent("closed")
+	titledClose.PullRequest.Title = stringRef("Fix typo [skip preview]")
+	tests := []struct {
+		name  string
+		event github.PullRequestEvent
+		want  string
+	}{
+		{name: "processed", event: testPullRequestEvent("opened"), want: ""},
+		{name: "bot sender", event: botSender, want: SkipReasonBot},
+		{name: "bot author on close", event: botAuthor, want: SkipReasonBot},
+		{name: "bot closing a person's pull request", event: botCloser, want: ""},
+		{name: "fork", event: fork, want: SkipReasonFork},
+		{name: "base branch", event: pages, want: SkipReasonBaseBranch},
+		{name: "base branch on close", event: pagesClose, want: ""},
+		{name: "draft", event: draftEvent("opened"), want: SkipReasonDraft},
+		{name: "converted to draft is torn down", event: draftEvent("converted_to_draft"), want: ""},
+		{name: "label", event: labeledEvent("synchronize", "dependencies"), want: SkipReasonLabel},
+		{name: "title marker", event: titled, want: SkipReasonTitleMarker},
+		{name: "title marker on close", event: titledClose, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := filter
+			f.Registry = metrics.NewRegistry()
+			assert.Equal(t, tt.want, f.Check(tt.event))
+			if tt.want != "" {
+				counter := metrics.GetOrRegisterCounter(MetricsKeySkippedEvents+"."+tt.want, f.Registry)
+				assert.Equal(t, int64(1), counter.Count())
+			}
+		})
+	}
+}
+
+func TestEventFilter_CheckDisabled(t *testing.T) {
+	event := draftEvent("opened")
+	event.Sender = &github.User{Type: stringRef("Bot")}
+	f := EventFilter{Registry: metrics.NewRegistry()}
+	assert.Equal(t, "", f.Check(event))
+}
@@ -0,0 +1,84 @@
+package business
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"net/http"
+)
+
+// MergeHook runs when a pull request is merged, before its preview is
+// cleaned up, for example to promote the preview or start a production
+// deploy. Merged events can be retried, so hooks must be idempotent.
+type MergeHook interface {
+	Merged(ctx context.Context, event github.PullRequestEvent, previewURL string) error
+}
+
+// MergeHookPayload is the JSON body WebhookMergeHook posts.
+type MergeHookPayload struct {
+	Repo           string `json:"repo"`
+	Number         int    `json:"number"`
+	HeadSHA        string `json:"head_sha"`
+	MergeCommitSHA string `json:"merge_commit_sha"`
+	BaseBranch     string `json:"base_branch"`
+	PreviewURL     string `json:"preview_url"`
+	MergedBy       string `json:"merged_by"`
+}
+
+// WebhookMergeHook posts a MergeHookPayload to a deploy hook URL. When
+// Secret is set the body is signed with HMAC-SHA256 in the
+// X-Preview-Signature-256 header, in the same "sha256=<hex>" form GitHub
+// uses for webhooks.
+type WebhookMergeHook struct {
+	URL    string
+	Secret string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+func (h *WebhookMergeHook) Merged(ctx context.Context, event github.PullRequestEvent, previewURL string) error {
+	pr := event.GetPullRequest()
+	body, err := json.Marshal(MergeHookPayload{
+		Repo:           newCommentData(event, previewURL).Repo,
+		Number:         event.GetNumber(),
+		HeadSHA:        pr.GetHead().GetSHA(),
+		MergeCommitSHA: pr.GetMergeCommitSHA(),
+		BaseBranch:     pr.GetBase().GetRef(),
+		PreviewURL:     previewURL,
+		MergedBy:       pr.GetMergedBy().GetLogin(),
+	})
+	if err != nil {
+		return Permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(h.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Preview-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Retryable(fmt.Errorf("merge hook: %w", err))
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return Retryable(fmt.Errorf("merge hook: %s", resp.Status))
+	case resp.StatusCode >= 300:
+		return Permanent(fmt.Errorf("merge hook: %s", resp.Status))
+	}
+	return nil
+}
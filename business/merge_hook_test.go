@@ -0,0 +1,65 @@
+package business
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookMergeHook_Merged(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		secret   string
+		wantKind ErrorKind
+		wantErr  bool
+	}{
+		{name: "accepted", status: http.StatusAccepted},
+		{name: "signed", status: http.StatusOK, secret: "s3cret"},
+		{name: "server error", status: http.StatusBadGateway, wantErr: true, wantKind: RetryableError},
+		{name: "rejected", status: http.StatusBadRequest, wantErr: true, wantKind: PermanentError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got MergeHookPayload
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.NoError(t, json.Unmarshal(body, &got))
+				if tt.secret != "" {
+					mac := hmac.New(sha256.New, []byte(tt.secret))
+					mac.Write(body)
+					assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), r.Header.Get("X-Preview-Signature-256"))
+				} else {
+					assert.Empty(t, r.Header.Get("X-Preview-Signature-256"))
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			h := &WebhookMergeHook{URL: srv.URL, Secret: tt.secret}
+			err := h.Merged(context.Background(), mergedEvent(), "https://pr-10.example.com")
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Equal(t, tt.wantKind, Classify(err))
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, MergeHookPayload{
+				Repo:           "foo/bar",
+				Number:         10,
+				HeadSHA:        "0123456789abcdef",
+				MergeCommitSHA: "fedcba9876543210",
+				BaseBranch:     "main",
+				PreviewURL:     "https://pr-10.example.com",
+			}, got)
+		})
+	}
+}
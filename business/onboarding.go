@@ -0,0 +1,154 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"net/http"
+)
+
+const (
+	// DefaultConfigPath is where repositories keep their app configuration.
+	DefaultConfigPath = ".github/preview.yml"
+	// OnboardingBranch is the branch the onboarding pull request is opened from.
+	OnboardingBranch = "preview/onboarding"
+
+	onboardingTitle = "Configure pull request previews"
+	onboardingBody  = "This pull request adds a starter configuration for pull request previews. " +
+		"Merge it to keep the defaults, or edit `" + DefaultConfigPath + "` first. " +
+		"Previews work without the file, so closing this pull request is fine too."
+)
+
+// StarterConfig is the app configuration proposed to newly added repositories.
+const StarterConfig = `# Pull request preview configuration.
+# Previews are built for every pull request that is not a draft and is not
+# labeled "no-preview". Comment "/preview help" on a pull request for the
+# available commands.
+#
+# The preview comment can be reworded with Go templates. Templates can use
+# .Number, .Title, .Author, .HeadSHA, .ShortSHA, .Branch, .BaseBranch, .Repo,
+# .Owner, .RepoName, .PreviewURL, .Label, .MergeSHA and .ShortMergeSHA, for
+# example:
+#
+# templates:
+#   deployed: "Preview of {{.ShortSHA}} is ready at {{.PreviewURL}}"
+#   destroyed: "The preview of #{{.Number}} was removed."
+templates: {}
+`
+
+// OnboardingHandler proposes a starter app configuration to a repository by
+// opening a pull request that adds it. Repositories that already have the
+// file, or had an onboarding pull request, are left alone.
+type OnboardingHandler struct {
+	// ConfigPath defaults to DefaultConfigPath.
+	ConfigPath string
+	// Content defaults to StarterConfig.
+	Content string
+}
+
+func (h *OnboardingHandler) configPath() string {
+	if h.ConfigPath != "" {
+		return h.ConfigPath
+	}
+	return DefaultConfigPath
+}
+
+func (h *OnboardingHandler) content() string {
+	if h.Content != "" {
+		return h.Content
+	}
+	return StarterConfig
+}
+
+// Handle opens the onboarding pull request on owner/repo and returns it, or
+// nil when the repository needs no onboarding.
+func (h *OnboardingHandler) Handle(ctx context.Context, client *github.Client, owner, repo string) (*github.PullRequest, error) {
+	repository, _, err := client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return nil, err
+	}
+	if repository.GetArchived() {
+		return nil, nil
+	}
+	base := repository.GetDefaultBranch()
+
+	// the repository is already configured.
+	_, _, resp, err := client.Repositories.GetContents(ctx, owner, repo, h.configPath(),
+		&github.RepositoryContentGetOptions{Ref: base})
+	if err == nil {
+		return nil, nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return nil, err
+	}
+
+	// onboarding was offered before, whether or not it was merged.
+	prs, _, err := client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+		State: "all",
+		Head:  owner + ":" + OnboardingBranch,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(prs) > 0 {
+		return nil, nil
+	}
+
+	// an earlier attempt may have failed after creating the branch or the
+	// file, so only the missing steps are done.
+	if err := h.createBranch(ctx, client, owner, repo, base); err != nil {
+		return nil, err
+	}
+	if err := h.createConfig(ctx, client, owner, repo); err != nil {
+		return nil, err
+	}
+	pr, _, err := client.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+		Title: github.String(onboardingTitle),
+		Head:  github.String(OnboardingBranch),
+		Base:  github.String(base),
+		Body:  github.String(onboardingBody),
+	})
+	return pr, err
+}
+
+// createBranch creates the onboarding branch from base unless it exists.
+func (h *OnboardingHandler) createBranch(ctx context.Context, client *github.Client, owner, repo, base string) error {
+	_, resp, err := client.Git.GetRef(ctx, owner, repo, "heads/"+OnboardingBranch)
+	if err == nil {
+		return nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return err
+	}
+	baseRef, resp, err := client.Git.GetRef(ctx, owner, repo, "heads/"+base)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusConflict {
+			// empty repositories have no commit to branch from.
+			return Ignored(err)
+		}
+		return err
+	}
+	_, _, err = client.Git.CreateRef(ctx, owner, repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + OnboardingBranch),
+		Object: &github.GitObject{SHA: baseRef.GetObject().SHA},
+	})
+	return err
+}
+
+// createConfig commits the starter configuration to the onboarding branch
+// unless it is there already.
+func (h *OnboardingHandler) createConfig(ctx context.Context, client *github.Client, owner, repo string) error {
+	_, _, resp, err := client.Repositories.GetContents(ctx, owner, repo, h.configPath(),
+		&github.RepositoryContentGetOptions{Ref: OnboardingBranch})
+	if err == nil {
+		return nil
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		return err
+	}
+	_, _, err = client.Repositories.CreateFile(ctx, owner, repo, h.configPath(), &github.RepositoryContentFileOptions{
+		Message: github.String("Add pull request preview configuration"),
+		Content: []byte(h.content()),
+		Branch:  github.String(OnboardingBranch),
+	})
+	return err
+}
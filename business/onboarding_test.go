@@ -0,0 +1,174 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// gitRefPattern matches refs containing slashes, which the generated pattern
+// does not.
+var gitRefPattern = mock.EndpointPattern{Pattern: "/repos/{owner}/{repo}/git/ref/{ref:.+}", Method: "GET"}
+
+// onboardingRepo is the state of a repository as seen by onboardingClient.
+type onboardingRepo struct {
+	// configStatus answers config lookups on the default branch.
+	configStatus int
+	// branches exist, and configured ones also hold the config.
+	branches   []string
+	configured []string
+	// pulls were opened from the onboarding branch before.
+	pulls int
+}
+
+// onboardingClient serves repo and counts the refs, files and pull requests
+// created.
+func onboardingClient(repo onboardingRepo, created map[string]int) *github.Client {
+	return github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatch(
+			mock.GetReposByOwnerByRepo,
+			github.Repository{DefaultBranch: github.String("main")},
+		),
+		mock.WithRequestMatchHandler(
+			mock.GetReposContentsByOwnerByRepoByPath,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := repo.configStatus
+				if ref := r.URL.Query().Get("ref"); ref != "main" {
+					status = http.StatusNotFound
+					if contains(repo.configured, ref) {
+						status = http.StatusOK
+					}
+				}
+				if status != http.StatusOK {
+					mock.WriteError(w, status, "contents")
+					return
+				}
+				w.Write(mock.MustMarshal(github.RepositoryContent{Path: github.String(DefaultConfigPath)}))
+			}),
+		),
+		mock.WithRequestMatchHandler(
+			mock.GetReposPullsByOwnerByRepo,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("head") != "foo:"+OnboardingBranch {
+					mock.WriteError(w, http.StatusBadRequest, "head")
+					return
+				}
+				w.Write(mock.MustMarshal(make([]github.PullRequest, repo.pulls)))
+			}),
+		),
+		mock.WithRequestMatchHandler(
+			gitRefPattern,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for _, branch := range repo.branches {
+					if strings.HasSuffix(r.URL.Path, "/git/ref/heads/"+branch) {
+						w.Write(mock.MustMarshal(github.Reference{
+							Ref:    github.String("refs/heads/" + branch),
+							Object: &github.GitObject{SHA: github.String("abc123")},
+						}))
+						return
+					}
+				}
+				mock.WriteError(w, http.StatusNotFound, "ref")
+			}),
+		),
+		mock.WithRequestMatchHandler(
+			mock.PostReposGitRefsByOwnerByRepo,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				created["ref"]++
+				w.Write(mock.MustMarshal(github.Reference{}))
+			}),
+		),
+		mock.WithRequestMatchHandler(
+			mock.PutReposContentsByOwnerByRepoByPath,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				created["file"]++
+				w.Write(mock.MustMarshal(github.RepositoryContentResponse{}))
+			}),
+		),
+		mock.WithRequestMatchHandler(
+			mock.PostReposPullsByOwnerByRepo,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				created["pull"]++
+				w.Write(mock.MustMarshal(github.PullRequest{Number: github.Int(1)}))
+			}),
+		),
+	))
+}
+
+func TestOnboardingHandler_Handle(t *testing.T) {
+	tests := []struct {
+		name        string
+		repo        onboardingRepo
+		wantCreated map[string]int
+		wantPR      bool
+		wantErr     assert.ErrorAssertionFunc
+	}{
+		{
+			name:        "opens onboarding pull request",
+			repo:        onboardingRepo{configStatus: http.StatusNotFound, branches: []string{"main"}},
+			wantCreated: map[string]int{"ref": 1, "file": 1, "pull": 1},
+			wantPR:      true,
+			wantErr:     assert.NoError,
+		},
+		{
+			name:        "already configured",
+			repo:        onboardingRepo{configStatus: http.StatusOK, branches: []string{"main"}},
+			wantCreated: map[string]int{},
+			wantErr:     assert.NoError,
+		},
+		{
+			name:        "onboarding pull request opened before",
+			repo:        onboardingRepo{configStatus: http.StatusNotFound, branches: []string{"main", OnboardingBranch}, configured: []string{OnboardingBranch}, pulls: 1},
+			wantCreated: map[string]int{},
+			wantErr:     assert.NoError,
+		},
+		{
+			name:        "branch left by a failed attempt",
+			repo:        onboardingRepo{configStatus: http.StatusNotFound, branches: []string{"main", OnboardingBranch}},
+			wantCreated: map[string]int{"file": 1, "pull": 1},
+			wantPR:      true,
+			wantErr:     assert.NoError,
+		},
+		{
+			name:        "branch and file left by a failed attempt",
+			repo:        onboardingRepo{configStatus: http.StatusNotFound, branches: []string{"main", OnboardingBranch}, configured: []string{OnboardingBranch}},
+			wantCreated: map[string]int{"pull": 1},
+			wantPR:      true,
+			wantErr:     assert.NoError,
+		},
+		{
+			name:        "config lookup fails",
+			repo:        onboardingRepo{configStatus: http.StatusInternalServerError, branches: []string{"main"}},
+			wantCreated: map[string]int{},
+			wantErr:     assert.Error,
+		},
+		{
+			name:        "default branch missing",
+			repo:        onboardingRepo{configStatus: http.StatusNotFound},
+			wantCreated: map[string]int{},
+			wantErr:     assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := map[string]int{}
+			h := &OnboardingHandler{}
+			pr, err := h.Handle(context.Background(), onboardingClient(tt.repo, created), "foo", "bar")
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.wantPR, pr != nil)
+			assert.Equal(t, tt.wantCreated, created)
+		})
+	}
+}
+
+func TestStarterConfig(t *testing.T) {
+	var rc RepoConfig
+	assert.NoError(t, yaml.Unmarshal([]byte(StarterConfig), &rc))
+	_, err := ParseTemplates(nil, rc.Templates)
+	assert.NoError(t, err)
+}
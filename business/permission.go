@@ -0,0 +1,120 @@
+package business
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"net/http"
+	"strings"
+)
+
+// Permission is a repository role, ordered from least to most privileged.
+type Permission int
+
+const (
+	PermissionNone Permission = iota
+	PermissionRead
+	PermissionTriage
+	PermissionWrite
+	PermissionMaintain
+	PermissionAdmin
+)
+
+var permissionNames = []string{"none", "read", "triage", "write", "maintain", "admin"}
+
+func (p Permission) String() string {
+	if p < PermissionNone || p > PermissionAdmin {
+		return fmt.Sprintf("Permission(%d)", int(p))
+	}
+	return permissionNames[p]
+}
+
+// ParsePermission converts a role name such as "write" into a Permission.
+func ParsePermission(s string) (Permission, error) {
+	for i, name := range permissionNames {
+		if strings.EqualFold(s, name) {
+			return Permission(i), nil
+		}
+	}
+	return PermissionNone, fmt.Errorf("unknown permission level %q", s)
+}
+
+// collaboratorPermission is the collaborator permission response. go-github
+// does not expose role_name, which is the only field that distinguishes
+// triage and maintain from read and write.
+type collaboratorPermission struct {
+	Permission string `json:"permission"`
+	RoleName   string `json:"role_name"`
+}
+
+// PermissionChecker decides whether a user may run slash commands.
+type PermissionChecker struct {
+	// MinPermission is the lowest repository role allowed to run commands.
+	MinPermission Permission
+	// Teams optionally restricts commands to members of at least one of the
+	// listed teams, given as "org/team-slug".
+	Teams []string
+}
+
+// Authorize reports whether user may run commands on the repository. When
+// the user is rejected, the returned string explains why.
+func (c *PermissionChecker) Authorize(ctx context.Context, client *github.Client, owner, repo, user string) (bool, string, error) {
+	perm, err := userPermission(ctx, client, owner, repo, user)
+	if err != nil {
+		return false, "", err
+	}
+	if perm < c.MinPermission {
+		reason := fmt.Sprintf("@%s needs at least %s permission on this repository to run commands, but has %s", user, c.MinPermission, perm)
+		return false, reason, nil
+	}
+	if len(c.Teams) == 0 {
+		return true, "", nil
+	}
+	for _, team := range c.Teams {
+		member, err := teamMember(ctx, client, team, user)
+		if err != nil {
+			return false, "", err
+		}
+		if member {
+			return true, "", nil
+		}
+	}
+	reason := fmt.Sprintf("@%s must be a member of one of these teams to run commands: %s", user, strings.Join(c.Teams, ", "))
+	return false, reason, nil
+}
+
+func userPermission(ctx context.Context, client *github.Client, owner, repo, user string) (Permission, error) {
+	u := fmt.Sprintf("repos/%v/%v/collaborators/%v/permission", owner, repo, user)
+	req, err := client.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return PermissionNone, err
+	}
+	var level collaboratorPermission
+	if _, err := client.Do(ctx, req, &level); err != nil {
+		return PermissionNone, err
+	}
+	if perm, err := ParsePermission(level.RoleName); err == nil {
+		return perm, nil
+	}
+	// custom roles fall back to the base permission they extend.
+	perm, err := ParsePermission(level.Permission)
+	if err != nil {
+		return PermissionNone, nil
+	}
+	return perm, nil
+}
+
+func teamMember(ctx context.Context, client *github.Client, team, user string) (bool, error) {
+	org, slug, ok := strings.Cut(team, "/")
+	if !ok {
+		return false, Permanent(fmt.Errorf("team %q must be in the form org/team-slug", team))
+	}
+	membership, resp, err := client.Teams.GetTeamMembershipBySlug(ctx, org, slug, user)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return membership.GetState() == "active", nil
+}
@@ -0,0 +1,123 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func mockedPermissionClient(level collaboratorPermission, teamStatus int) *github.Client {
+	return github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatch(mock.GetReposCollaboratorsPermissionByOwnerByRepoByUsername, level),
+		mock.WithRequestMatchHandler(
+			mock.GetOrgsTeamsMembershipsByOrgByTeamSlugByUsername,
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if teamStatus != http.StatusOK {
+					mock.WriteError(w, teamStatus, "team membership")
+					return
+				}
+				w.Write([]byte(`{"state": "active"}`))
+			}),
+		),
+	))
+}
+
+func TestParsePermission(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Permission
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{name: "triage", s: "triage", want: PermissionTriage, wantErr: assert.NoError},
+		{name: "mixed case", s: "Maintain", want: PermissionMaintain, wantErr: assert.NoError},
+		{name: "unknown", s: "owner", want: PermissionNone, wantErr: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePermission(tt.s)
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPermissionChecker_Authorize(t *testing.T) {
+	tests := []struct {
+		name        string
+		checker     PermissionChecker
+		client      *github.Client
+		wantAllowed bool
+		wantErr     assert.ErrorAssertionFunc
+	}{
+		{
+			name:        "write meets write",
+			checker:     PermissionChecker{MinPermission: PermissionWrite},
+			client:      mockedPermissionClient(collaboratorPermission{Permission: "write", RoleName: "write"}, http.StatusOK),
+			wantAllowed: true,
+			wantErr:     assert.NoError,
+		},
+		{
+			name:        "triage below write",
+			checker:     PermissionChecker{MinPermission: PermissionWrite},
+			client:      mockedPermissionClient(collaboratorPermission{Permission: "read", RoleName: "triage"}, http.StatusOK),
+			wantAllowed: false,
+			wantErr:     assert.NoError,
+		},
+		{
+			name:        "custom role falls back to base permission",
+			checker:     PermissionChecker{MinPermission: PermissionWrite},
+			client:      mockedPermissionClient(collaboratorPermission{Permission: "write", RoleName: "deployer"}, http.StatusOK),
+			wantAllowed: true,
+			wantErr:     assert.NoError,
+		},
+		{
+			name:        "team member",
+			checker:     PermissionChecker{MinPermission: PermissionRead, Teams: []string{"acme/web"}},
+			client:      mockedPermissionClient(collaboratorPermission{Permission: "read", RoleName: "read"}, http.StatusOK),
+			wantAllowed: true,
+			wantErr:     assert.NoError,
+		},
+		{
+			name:        "not a team member",
+			checker:     PermissionChecker{MinPermission: PermissionRead, Teams: []string{"acme/web"}},
+			client:      mockedPermissionClient(collaboratorPermission{Permission: "admin", RoleName: "admin"}, http.StatusNotFound),
+			wantAllowed: false,
+			wantErr:     assert.NoError,
+		},
+		{
+			name:        "malformed team",
+			checker:     PermissionChecker{MinPermission: PermissionRead, Teams: []string{"web"}},
+			client:      mockedPermissionClient(collaboratorPermission{Permission: "admin", RoleName: "admin"}, http.StatusOK),
+			wantAllowed: false,
+			wantErr:     assert.Error,
+		},
+		{
+			name:        "team lookup error",
+			checker:     PermissionChecker{MinPermission: PermissionRead, Teams: []string{"acme/web"}},
+			client:      mockedPermissionClient(collaboratorPermission{Permission: "admin", RoleName: "admin"}, http.StatusInternalServerError),
+			wantAllowed: false,
+			wantErr:     assert.Error,
+		},
+		{
+			name:        "permission lookup error",
+			checker:     PermissionChecker{MinPermission: PermissionRead},
+			client:      mockedErrorGithubClient(""),
+			wantAllowed: false,
+			wantErr:     assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, reason, err := tt.checker.Authorize(context.Background(), tt.client, "foo", "bar", "octocat")
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.wantAllowed, allowed)
+			if err == nil && !allowed {
+				assert.NotEmpty(t, reason)
+			}
+		})
+	}
+}
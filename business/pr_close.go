@@ -2,20 +2,39 @@ package business
 
 import (
 	"context"
+	"errors"
 	"github.com/google/go-github/v47/github"
 )
 
-type PRCloseHandler struct{}
+// PRCloseHandler cleans up the preview of a closed pull request. Merged pull
+// requests run the merge hook first and get a "shipped" message instead.
+type PRCloseHandler struct {
+	PreviewDeps
+	// MergeHook runs for merged pull requests. Nothing is promoted when it is
+	// nil.
+	MergeHook MergeHook
+}
 
 func (h *PRCloseHandler) Handle(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
-	msg := "your site has been cleaned up"
-	repo := event.GetRepo()
-	repoName := repo.GetName()
-	prNum := event.GetNumber()
-	repoOwner := repo.GetOwner().GetLogin()
-	comment := &github.IssueComment{
-		Body: &msg,
+	if event.GetPullRequest().GetMerged() {
+		return h.merged(ctx, client, event)
+	}
+	return h.closed(ctx, client, event)
+}
+
+// merged promotes the preview of a merged pull request and cleans it up. The
+// preview is cleaned up even when the merge hook fails, and the hook's error
+// is returned after it.
+func (h *PRCloseHandler) merged(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	url := h.URLs.URL(event)
+	var hookErr error
+	if h.MergeHook != nil {
+		hookErr = h.MergeHook.Merged(ctx, event, url)
 	}
-	_, _, err := client.Issues.CreateComment(ctx, repoOwner, repoName, prNum, comment)
-	return err
+	return errors.Join(hookErr, h.retire(ctx, client, event, TemplateShipped))
+}
+
+// closed cleans up the preview of a pull request closed without merging.
+func (h *PRCloseHandler) closed(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	return h.retire(ctx, client, event, TemplateDestroyed)
 }
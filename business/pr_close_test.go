@@ -2,6 +2,7 @@ package business
 
 import (
 	"context"
+	"errors"
 	"github.com/google/go-github/v47/github"
 	"github.com/migueleliasweb/go-github-mock/src/mock"
 	"net/http"
@@ -12,6 +13,7 @@ func mockedGithubClient(msg string) *github.Client {
 	endpoint := mock.PostReposIssuesCommentsByOwnerByRepoByIssueNumber
 	expected := github.IssueComment{Body: &msg}
 	mockedHttpClient := mock.NewMockedHTTPClient(
+		mock.WithRequestMatch(mock.GetReposIssuesCommentsByOwnerByRepoByIssueNumber, []github.IssueComment{}),
 		mock.WithRequestMatch(endpoint, expected),
 	)
 	return github.NewClient(mockedHttpClient)
@@ -20,6 +22,7 @@ func mockedGithubClient(msg string) *github.Client {
 func mockedErrorGithubClient(msg string) *github.Client {
 	endpoint := mock.PostReposIssuesCommentsByOwnerByRepoByIssueNumber
 	httpClient := mock.NewMockedHTTPClient(
+		mock.WithRequestMatch(mock.GetReposIssuesCommentsByOwnerByRepoByIssueNumber, []github.IssueComment{}),
 		mock.WithRequestMatchHandler(
 			endpoint,
 			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -42,6 +45,23 @@ func stringRef(s string) *string {
 	return &s
 }
 
+type fakeMergeHook struct {
+	calls int
+	err   error
+}
+
+func (h *fakeMergeHook) Merged(ctx context.Context, event github.PullRequestEvent, previewURL string) error {
+	h.calls++
+	return h.err
+}
+
+func mergedEvent() github.PullRequestEvent {
+	event := testPullRequestEvent("closed")
+	event.PullRequest.Merged = boolRef(true)
+	event.PullRequest.MergeCommitSHA = stringRef("fedcba9876543210")
+	return event
+}
+
 func TestPRCloseHandler_Handle(t *testing.T) {
 	type args struct {
 		ctx    context.Context
@@ -49,9 +69,11 @@ func TestPRCloseHandler_Handle(t *testing.T) {
 		event  github.PullRequestEvent
 	}
 	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
+		name          string
+		args          args
+		hook          *fakeMergeHook
+		wantErr       bool
+		wantHookCalls int
 	}{
 		{
 			name: "standard comment",
@@ -83,13 +105,79 @@ func TestPRCloseHandler_Handle(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "merged without a hook",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedGithubClient("shipped in fedcba9, your site has been cleaned up"),
+				event:  mergedEvent(),
+			},
+			wantErr: false,
+		},
+		{
+			name: "merged runs the hook",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedGithubClient("shipped in fedcba9, your site has been cleaned up"),
+				event:  mergedEvent(),
+			},
+			hook:          &fakeMergeHook{},
+			wantErr:       false,
+			wantHookCalls: 1,
+		},
+		{
+			name: "merge hook failure still cleans up",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedGithubClient("shipped in fedcba9, your site has been cleaned up"),
+				event:  mergedEvent(),
+			},
+			hook:          &fakeMergeHook{err: errors.New("deploy failed")},
+			wantErr:       true,
+			wantHookCalls: 1,
+		},
+		{
+			name: "closed without merge skips the hook",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedGithubClient("your site has been cleaned up"),
+				event:  testPullRequestEvent("closed"),
+			},
+			hook:    &fakeMergeHook{},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := &PRCloseHandler{}
+			if tt.hook != nil {
+				h.MergeHook = tt.hook
+			}
 			if err := h.Handle(tt.args.ctx, tt.args.client, tt.args.event); (err != nil) != tt.wantErr {
 				t.Errorf("Handle() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if tt.hook != nil && tt.hook.calls != tt.wantHookCalls {
+				t.Errorf("merge hook calls = %d, want %d", tt.hook.calls, tt.wantHookCalls)
+			}
 		})
 	}
 }
+
+func TestPRCloseHandler_mergeHookFailure(t *testing.T) {
+	ctx := context.Background()
+	event := mergedEvent()
+	provisioner := NewMemoryProvisioner()
+	preview := newPreview(event, DefaultPreviewURLPattern)
+	if err := provisioner.Deploy(ctx, nil, preview); err != nil {
+		t.Fatal(err)
+	}
+	hookErr := Permanent(errors.New("promotion rejected"))
+	h := &PRCloseHandler{PreviewDeps: PreviewDeps{Provisioner: provisioner}, MergeHook: &fakeMergeHook{err: hookErr}}
+	err := h.Handle(ctx, mockedGithubClient("shipped in fedcba9, your site has been cleaned up"), event)
+	if !errors.Is(err, hookErr) || Classify(err) != PermanentError {
+		t.Errorf("Handle() error = %v, want the merge hook error", err)
+	}
+	if _, ok, _ := provisioner.Status(ctx, nil, preview); ok {
+		t.Error("preview was not destroyed")
+	}
+}
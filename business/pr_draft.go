@@ -0,0 +1,33 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+)
+
+// PRReadyForReviewHandler creates the preview that was deferred while the
+// pull request was a draft.
+type PRReadyForReviewHandler struct {
+	PreviewDeps
+}
+
+func (h *PRReadyForReviewHandler) Handle(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	if !previewEnabled(event.GetPullRequest()) {
+		return nil
+	}
+	return h.publish(ctx, client, event, TemplateDeployed)
+}
+
+// PRConvertedToDraftHandler removes the preview when a pull request goes back
+// to being a draft.
+type PRConvertedToDraftHandler struct {
+	PreviewDeps
+}
+
+func (h *PRConvertedToDraftHandler) Handle(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	if hasLabel(event.GetPullRequest(), NoPreviewLabel) {
+		// there is no preview to remove.
+		return nil
+	}
+	return h.retire(ctx, client, event, TemplateDrafted)
+}
@@ -0,0 +1,105 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"testing"
+)
+
+func TestPRReadyForReviewHandler_Handle(t *testing.T) {
+	type args struct {
+		ctx    context.Context
+		client *github.Client
+		event  github.PullRequestEvent
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "preview comment",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedGithubClient(""),
+				event:  testPullRequestEvent("ready_for_review"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "no-preview label is skipped",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  labeledEvent("ready_for_review", NoPreviewLabel),
+			},
+			wantErr: false,
+		},
+		{
+			name: "github client error",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  testPullRequestEvent("ready_for_review"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PRReadyForReviewHandler{}
+			if err := h.Handle(tt.args.ctx, tt.args.client, tt.args.event); (err != nil) != tt.wantErr {
+				t.Errorf("Handle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPRConvertedToDraftHandler_Handle(t *testing.T) {
+	type args struct {
+		ctx    context.Context
+		client *github.Client
+		event  github.PullRequestEvent
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "cleanup comment",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedGithubClient(""),
+				event:  draftEvent("converted_to_draft"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "no-preview label is skipped",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  labeledEvent("converted_to_draft", NoPreviewLabel),
+			},
+			wantErr: false,
+		},
+		{
+			name: "github client error",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  draftEvent("converted_to_draft"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PRConvertedToDraftHandler{}
+			if err := h.Handle(tt.args.ctx, tt.args.client, tt.args.event); (err != nil) != tt.wantErr {
+				t.Errorf("Handle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
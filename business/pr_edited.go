@@ -0,0 +1,19 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+)
+
+// PREditedHandler refreshes the preview when the base branch of a pull
+// request changes. Title and body edits do not affect the site.
+type PREditedHandler struct {
+	PreviewDeps
+}
+
+func (h *PREditedHandler) Handle(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	if event.GetChanges().GetBase() == nil || !previewEnabled(event.GetPullRequest()) {
+		return nil
+	}
+	return h.publish(ctx, client, event, TemplateBaseChanged)
+}
@@ -0,0 +1,64 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"testing"
+)
+
+func baseChangedEvent() github.PullRequestEvent {
+	event := testPullRequestEvent("edited")
+	event.Changes = &github.EditChange{
+		Base: &github.EditBase{Ref: &github.EditRef{From: stringRef("develop")}},
+	}
+	return event
+}
+
+func TestPREditedHandler_Handle(t *testing.T) {
+	type args struct {
+		ctx    context.Context
+		client *github.Client
+		event  github.PullRequestEvent
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "base branch changed",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedGithubClient(""),
+				event:  baseChangedEvent(),
+			},
+			wantErr: false,
+		},
+		{
+			name: "title edit is ignored",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  testPullRequestEvent("edited"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "github client error",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  baseChangedEvent(),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PREditedHandler{}
+			if err := h.Handle(tt.args.ctx, tt.args.client, tt.args.event); (err != nil) != tt.wantErr {
+				t.Errorf("Handle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
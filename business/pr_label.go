@@ -0,0 +1,32 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+)
+
+// PRLabeledHandler removes the preview when NoPreviewLabel is added.
+type PRLabeledHandler struct {
+	PreviewDeps
+}
+
+func (h *PRLabeledHandler) Handle(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	pr := event.GetPullRequest()
+	if event.GetLabel().GetName() != NoPreviewLabel || pr.GetDraft() || pr.GetState() == "closed" {
+		// there is no preview to remove.
+		return nil
+	}
+	return h.retire(ctx, client, event, TemplateLabeled)
+}
+
+// PRUnlabeledHandler creates the preview again when NoPreviewLabel is removed.
+type PRUnlabeledHandler struct {
+	PreviewDeps
+}
+
+func (h *PRUnlabeledHandler) Handle(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	if event.GetLabel().GetName() != NoPreviewLabel || !previewEnabled(event.GetPullRequest()) {
+		return nil
+	}
+	return h.publish(ctx, client, event, TemplateDeployed)
+}
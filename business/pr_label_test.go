@@ -0,0 +1,134 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"testing"
+)
+
+func unlabeledEvent(label string) github.PullRequestEvent {
+	event := testPullRequestEvent("unlabeled")
+	event.Label = &github.Label{Name: stringRef(label)}
+	return event
+}
+
+func closedEvent(event github.PullRequestEvent) github.PullRequestEvent {
+	event.PullRequest.State = stringRef("closed")
+	return event
+}
+
+func TestPRLabeledHandler_Handle(t *testing.T) {
+	type args struct {
+		ctx    context.Context
+		client *github.Client
+		event  github.PullRequestEvent
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "no-preview label cleans up",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedGithubClient(""),
+				event:  labeledEvent("labeled", NoPreviewLabel),
+			},
+			wantErr: false,
+		},
+		{
+			name: "other label is ignored",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  labeledEvent("labeled", "bug"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "closed pull request is ignored",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  closedEvent(labeledEvent("labeled", NoPreviewLabel)),
+			},
+			wantErr: false,
+		},
+		{
+			name: "github client error",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  labeledEvent("labeled", NoPreviewLabel),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PRLabeledHandler{}
+			if err := h.Handle(tt.args.ctx, tt.args.client, tt.args.event); (err != nil) != tt.wantErr {
+				t.Errorf("Handle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPRUnlabeledHandler_Handle(t *testing.T) {
+	type args struct {
+		ctx    context.Context
+		client *github.Client
+		event  github.PullRequestEvent
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "no-preview label removed",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedGithubClient(""),
+				event:  unlabeledEvent(NoPreviewLabel),
+			},
+			wantErr: false,
+		},
+		{
+			name: "other label is ignored",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  unlabeledEvent("bug"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "closed pull request is ignored",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  closedEvent(unlabeledEvent(NoPreviewLabel)),
+			},
+			wantErr: false,
+		},
+		{
+			name: "github client error",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  unlabeledEvent(NoPreviewLabel),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PRUnlabeledHandler{}
+			if err := h.Handle(tt.args.ctx, tt.args.client, tt.args.event); (err != nil) != tt.wantErr {
+				t.Errorf("Handle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
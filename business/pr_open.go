@@ -5,17 +5,15 @@ import (
 	"github.com/google/go-github/v47/github"
 )
 
-type PROpenHandler struct{}
+// PROpenHandler publishes the preview of a newly opened pull request.
+type PROpenHandler struct {
+	PreviewDeps
+}
 
 func (h *PROpenHandler) Handle(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
-	msg := "preview your site at: http://example.com/site"
-	repo := event.GetRepo()
-	repoName := repo.GetName()
-	prNum := event.GetNumber()
-	repoOwner := repo.GetOwner().GetLogin()
-	comment := &github.IssueComment{
-		Body: &msg,
+	if !previewEnabled(event.GetPullRequest()) {
+		// drafts get their preview once they are ready for review.
+		return nil
 	}
-	_, _, err := client.Issues.CreateComment(ctx, repoOwner, repoName, prNum, comment)
-	return err
+	return h.publish(ctx, client, event, TemplateDeployed)
 }
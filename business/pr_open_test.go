@@ -31,6 +31,15 @@ func TestPROpenHandler_Handle(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "draft is deferred",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  draftEvent("opened"),
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,17 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+)
+
+type PRReopenHandler struct {
+	PreviewDeps
+}
+
+func (h *PRReopenHandler) Handle(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	if !previewEnabled(event.GetPullRequest()) {
+		return nil
+	}
+	return h.publish(ctx, client, event, TemplateRestored)
+}
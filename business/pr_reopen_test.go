@@ -0,0 +1,69 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"testing"
+)
+
+func draftEvent(action string) github.PullRequestEvent {
+	event := testPullRequestEvent(action)
+	event.PullRequest.Draft = boolRef(true)
+	return event
+}
+
+func labeledEvent(action, label string) github.PullRequestEvent {
+	event := testPullRequestEvent(action)
+	event.Label = &github.Label{Name: stringRef(label)}
+	event.PullRequest.Labels = []*github.Label{event.Label}
+	return event
+}
+
+func TestPRReopenHandler_Handle(t *testing.T) {
+	type args struct {
+		ctx    context.Context
+		client *github.Client
+		event  github.PullRequestEvent
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "restore comment",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedGithubClient(""),
+				event:  testPullRequestEvent("reopened"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "draft is skipped",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  draftEvent("reopened"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "github client error",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  testPullRequestEvent("reopened"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PRReopenHandler{}
+			if err := h.Handle(tt.args.ctx, tt.args.client, tt.args.event); (err != nil) != tt.wantErr {
+				t.Errorf("Handle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+)
+
+type PRSynchronizeHandler struct {
+	PreviewDeps
+}
+
+func (h *PRSynchronizeHandler) Handle(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	pr := event.GetPullRequest()
+	if !previewEnabled(pr) {
+		return nil
+	}
+	return h.publish(ctx, client, event, TemplateRefreshed)
+}
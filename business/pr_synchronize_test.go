@@ -0,0 +1,65 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"testing"
+)
+
+func TestPRSynchronizeHandler_Handle(t *testing.T) {
+	type args struct {
+		ctx    context.Context
+		client *github.Client
+		event  github.PullRequestEvent
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "refresh comment",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedGithubClient(""),
+				event:  testPullRequestEvent("synchronize"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "draft is skipped",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  draftEvent("synchronize"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "no-preview label is skipped",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  labeledEvent("synchronize", NoPreviewLabel),
+			},
+			wantErr: false,
+		},
+		{
+			name: "github client error",
+			args: args{
+				ctx:    context.Background(),
+				client: mockedErrorGithubClient(""),
+				event:  testPullRequestEvent("synchronize"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &PRSynchronizeHandler{}
+			if err := h.Handle(tt.args.ctx, tt.args.client, tt.args.event); (err != nil) != tt.wantErr {
+				t.Errorf("Handle() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
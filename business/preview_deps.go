@@ -0,0 +1,48 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+)
+
+// PreviewDeps holds what the pull request handlers need to publish and retire
+// previews. Handlers embed it, so the same dependencies are configured once.
+type PreviewDeps struct {
+	// Templates renders the preview comment. The built-in templates are used
+	// when it is nil.
+	Templates *TemplateLoader
+	// URLs computes the preview URL. DefaultPreviewURLPattern is used when
+	// it is nil.
+	URLs *PreviewURLs
+	// Provisioner creates and removes the preview site. Nothing is deployed
+	// when it is nil.
+	Provisioner Provisioner
+	// Deployments reports the preview as a GitHub deployment. Only the
+	// comment is posted when it is nil.
+	Deployments *Deployments
+	// Reporter reports the build of the preview, as a check run or a commit
+	// status. Builds are only reported in the comment when it is nil.
+	Reporter Reporter
+}
+
+// publish deploys the preview of the event's pull request and announces it
+// with the named template.
+func (d *PreviewDeps) publish(ctx context.Context, client *github.Client, event github.PullRequestEvent, template string) error {
+	url := d.URLs.URL(event)
+	msg, err := d.Templates.Render(ctx, client, event, template, url)
+	if err != nil {
+		return err
+	}
+	return publishPreview(ctx, client, d.Provisioner, d.Deployments, d.Reporter, event, url, msg)
+}
+
+// retire removes the preview of the event's pull request and reports it with
+// the named template.
+func (d *PreviewDeps) retire(ctx context.Context, client *github.Client, event github.PullRequestEvent, template string) error {
+	url := d.URLs.URL(event)
+	msg, err := d.Templates.Render(ctx, client, event, template, url)
+	if err != nil {
+		return err
+	}
+	return retirePreview(ctx, client, d.Provisioner, d.Deployments, d.Reporter, event, url, msg)
+}
@@ -0,0 +1,155 @@
+package business
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPreviewURLPattern is used when no pattern is configured.
+	DefaultPreviewURLPattern = previewURL
+
+	// maxLabelLength is the longest DNS label allowed.
+	maxLabelLength = 63
+	// maxBranchSlugLength keeps room in a host label for the other
+	// placeholders.
+	maxBranchSlugLength = 30
+)
+
+var (
+	placeholderRE = regexp.MustCompile(`\{([a-z_]*)\}`)
+	nonSlugRE     = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// previewURLPlaceholders lists what a pattern can refer to.
+var previewURLPlaceholders = map[string]bool{
+	"owner":       true,
+	"repo":        true,
+	"number":      true,
+	"branch_slug": true,
+	"sha_short":   true,
+}
+
+// PreviewURLs computes the preview URL of a pull request from a pattern such
+// as "https://pr-{number}--{repo}.previews.example.com". Placeholder values
+// are slugified so they are safe in host names and stay distinct, and host
+// labels longer than DNS allows are shortened with a hash suffix. The same
+// pull request always maps to the same URL unless the pattern uses
+// {sha_short} or {branch_slug}.
+type PreviewURLs struct {
+	pattern string
+}
+
+// NewPreviewURLs checks that pattern only uses known placeholders and
+// expands to a valid absolute URL.
+func NewPreviewURLs(pattern string) (*PreviewURLs, error) {
+	for _, m := range placeholderRE.FindAllStringSubmatch(pattern, -1) {
+		if !previewURLPlaceholders[m[1]] {
+			return nil, fmt.Errorf("unknown placeholder %s in preview URL pattern", m[0])
+		}
+	}
+	p := &PreviewURLs{pattern: pattern}
+	sample := p.expand(map[string]string{
+		"owner":       "octocat",
+		"repo":        "hello-world",
+		"number":      "1",
+		"branch_slug": "feature",
+		"sha_short":   "0123456",
+	})
+	u, err := url.Parse(sample)
+	if err != nil {
+		return nil, fmt.Errorf("invalid preview URL pattern: %w", err)
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return nil, fmt.Errorf("preview URL pattern %q must be an absolute URL", pattern)
+	}
+	return p, nil
+}
+
+// URL returns the preview URL of the pull request the event refers to. A nil
+// PreviewURLs uses DefaultPreviewURLPattern.
+func (p *PreviewURLs) URL(event github.PullRequestEvent) string {
+	if p == nil {
+		return DefaultPreviewURLPattern
+	}
+	pr := event.GetPullRequest()
+	return p.expand(map[string]string{
+		"owner":       Slugify(event.GetRepo().GetOwner().GetLogin(), maxLabelLength),
+		"repo":        Slugify(event.GetRepo().GetName(), maxLabelLength),
+		"number":      strconv.Itoa(event.GetNumber()),
+		"branch_slug": Slugify(pr.GetHead().GetRef(), maxBranchSlugLength),
+		"sha_short":   Slugify(shortSHA(pr.GetHead().GetSHA()), maxLabelLength),
+	})
+}
+
+// expand substitutes the placeholders and shortens overlong host labels.
+func (p *PreviewURLs) expand(values map[string]string) string {
+	expanded := placeholderRE.ReplaceAllStringFunc(p.pattern, func(m string) string {
+		return values[m[1:len(m)-1]]
+	})
+	u, err := url.Parse(expanded)
+	if err != nil || u.Host == "" {
+		return expanded
+	}
+	host := u.Hostname()
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		labels[i] = shortenLabel(label)
+	}
+	shortened := strings.Join(labels, ".")
+	if shortened == host {
+		return expanded
+	}
+	if port := u.Port(); port != "" {
+		shortened += ":" + port
+	}
+	u.Host = shortened
+	return u.String()
+}
+
+// Slugify turns s into lowercase letters, digits and single dashes, at most
+// max characters long. Slugs that had to change beyond lowercasing, or were
+// cut short, end in a hash of s, so distinct inputs keep distinct slugs. The
+// slug is never empty.
+func Slugify(s string, max int) string {
+	slug := strings.Trim(nonSlugRE.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if slug != "" && slug == strings.ToLower(s) && len(slug) <= max {
+		return slug
+	}
+	return truncateWithHash(slug, s, max)
+}
+
+func shortenLabel(label string) string {
+	if len(label) <= maxLabelLength {
+		return label
+	}
+	return truncateWithHash(label, label, maxLabelLength)
+}
+
+// truncateWithHash cuts slug short enough to end in a short hash of original
+// within max characters.
+func truncateWithHash(slug, original string, max int) string {
+	hash := shortHash(original)
+	if max <= len(hash) {
+		return hash[:max]
+	}
+	if len(slug) > max-len(hash)-1 {
+		slug = slug[:max-len(hash)-1]
+	}
+	prefix := strings.TrimRight(slug, "-")
+	if prefix == "" {
+		return hash
+	}
+	return prefix + "-" + hash
+}
+
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:6]
+}
@@ -0,0 +1,123 @@
+package business
+
+import (
+	"github.com/google/go-github/v47/github"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestNewPreviewURLs(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		wantErr bool
+	}{
+		{name: "host pattern", pattern: "https://pr-{number}--{repo}.previews.example.com"},
+		{name: "path pattern", pattern: "https://previews.example.com/{owner}/{repo}/{number}/{sha_short}/"},
+		{name: "constant", pattern: "http://example.com/site"},
+		{name: "unknown placeholder", pattern: "https://{branch}.example.com", wantErr: true},
+		{name: "relative", pattern: "/previews/{number}", wantErr: true},
+		{name: "not a url", pattern: "https://pr {number}.example.com:port", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPreviewURLs(tt.pattern)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func urlEvent(owner, repo, branch, sha string, number int) github.PullRequestEvent {
+	return github.PullRequestEvent{
+		Number: &number,
+		Repo: &github.Repository{
+			Owner: &github.User{Login: &owner},
+			Name:  &repo,
+		},
+		PullRequest: &github.PullRequest{
+			Head: &github.PullRequestBranch{Ref: &branch, SHA: &sha},
+		},
+	}
+}
+
+func TestPreviewURLs_URL(t *testing.T) {
+	longBranch := "feature/" + strings.Repeat("very-long-branch-name-", 5)
+	tests := []struct {
+		name    string
+		pattern string
+		event   github.PullRequestEvent
+		want    string
+	}{
+		{
+			name:    "host based",
+			pattern: "https://pr-{number}--{repo}.previews.example.com",
+			event:   urlEvent("Acme", "Web.Site", "main", "abcdef0123", 42),
+			want:    "https://pr-42--web-site-" + shortHash("Web.Site") + ".previews.example.com",
+		},
+		{
+			name:    "path based",
+			pattern: "https://previews.example.com/{owner}/{repo}/{sha_short}/",
+			event:   urlEvent("Acme", "web_site", "main", "ABCDEF0123", 42),
+			want:    "https://previews.example.com/acme/web-site-" + shortHash("web_site") + "/abcdef0/",
+		},
+		{
+			name:    "branch slug is shortened",
+			pattern: "https://{branch_slug}.example.com",
+			event:   urlEvent("acme", "web", longBranch, "abc", 1),
+			want:    "https://" + Slugify(longBranch, maxBranchSlugLength) + ".example.com",
+		},
+		{
+			name:    "long host label is shortened",
+			pattern: "https://{owner}-{repo}-{number}.example.com:8443/x",
+			event:   urlEvent(strings.Repeat("o", 40), strings.Repeat("r", 40), "main", "abc", 7),
+			want:    "https://" + shortenLabel(strings.Repeat("o", 40)+"-"+strings.Repeat("r", 40)+"-7") + ".example.com:8443/x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urls, err := NewPreviewURLs(tt.pattern)
+			assert.NoError(t, err)
+			got := urls.URL(tt.event)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, got, urls.URL(tt.event), "deterministic")
+		})
+	}
+
+	var urls *PreviewURLs
+	assert.Equal(t, DefaultPreviewURLPattern, urls.URL(urlEvent("acme", "web", "main", "abc", 1)))
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{in: "feature-add-thing", max: 63, want: "feature-add-thing"},
+		{in: "Feature", max: 63, want: "feature"},
+		{in: "Feature/Add_Thing", max: 63, want: "feature-add-thing-" + shortHash("Feature/Add_Thing")},
+		{in: "--weird..name--", max: 63, want: "weird-name-" + shortHash("--weird..name--")},
+		{in: "dependabot/npm_and_yarn/lodash-4.17.21", max: 63, want: "dependabot-npm-and-yarn-lodash-4-17-21-" + shortHash("dependabot/npm_and_yarn/lodash-4.17.21")},
+		{in: "ünïcode", max: 63, want: "n-code-" + shortHash("ünïcode")},
+		{in: "功能", max: 63, want: shortHash("功能")},
+		{in: "", max: 63, want: shortHash("")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			assert.Equal(t, tt.want, Slugify(tt.in, tt.max))
+		})
+	}
+
+	a := Slugify("feature/"+strings.Repeat("x", 40)+"-a", 20)
+	b := Slugify("feature/"+strings.Repeat("x", 40)+"-b", 20)
+	assert.Len(t, a, 20)
+	assert.NotEqual(t, a, b, "truncated slugs stay distinct")
+	assert.Regexp(t, "^[a-z0-9]+(-[a-z0-9]+)*$", a)
+
+	slugs := map[string]bool{}
+	for _, in := range []string{"my.site", "my-site", "My_Site"} {
+		slugs[Slugify(in, maxLabelLength)] = true
+	}
+	assert.Len(t, slugs, 3, "inputs that slugify alike stay distinct")
+}
@@ -0,0 +1,145 @@
+package business
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Preview identifies the preview of a pull request and the commit it is
+// built from.
+type Preview struct {
+	Owner   string
+	Repo    string
+	Number  int
+	HeadSHA string
+	Branch  string
+	URL     string
+}
+
+// Key identifies the pull request the preview belongs to.
+func (p Preview) Key() string {
+	return fmt.Sprintf("%s/%s#%d", strings.ToLower(p.Owner), strings.ToLower(p.Repo), p.Number)
+}
+
+// Path files the preview under "owner/repo/number", with owner and repo
+// slugified like the {owner} and {repo} placeholders of preview URLs.
+func (p Preview) Path() string {
+	return fmt.Sprintf("%s/%d", RepoPath(p.Owner, p.Repo), p.Number)
+}
+
+// RepoPath is the "owner/repo" prefix of the paths of a repository's
+// previews.
+func RepoPath(owner, repo string) string {
+	return Slugify(owner, maxLabelLength) + "/" + Slugify(repo, maxLabelLength)
+}
+
+// PreviewPath joins slugified owner and repo names and a pull request number
+// into a preview path.
+func PreviewPath(ownerSlug, repoSlug string, number int) string {
+	return fmt.Sprintf("%s/%s/%d", ownerSlug, repoSlug, number)
+}
+
+// newPreview describes the preview of the pull request event, served at
+// previewURL.
+func newPreview(event github.PullRequestEvent, previewURL string) Preview {
+	pr := event.GetPullRequest()
+	return Preview{
+		Owner:   event.GetRepo().GetOwner().GetLogin(),
+		Repo:    event.GetRepo().GetName(),
+		Number:  event.GetNumber(),
+		HeadSHA: pr.GetHead().GetSHA(),
+		Branch:  pr.GetHead().GetRef(),
+		URL:     previewURL,
+	}
+}
+
+// PreviewState is what a Provisioner knows about a deployed preview.
+type PreviewState struct {
+	HeadSHA   string
+	URL       string
+	UpdatedAt time.Time
+}
+
+// Provisioner creates and removes the sites behind previews. Deploy and
+// Destroy may run again for the same commit after a retry, so they must be
+// idempotent.
+type Provisioner interface {
+	// Deploy creates or updates the preview from its head commit.
+	Deploy(ctx context.Context, client *github.Client, preview Preview) error
+	// Destroy removes the preview. Removing a missing preview is not an
+	// error.
+	Destroy(ctx context.Context, client *github.Client, preview Preview) error
+	// Status returns the deployed state of the preview, or false when none
+	// is deployed.
+	Status(ctx context.Context, client *github.Client, preview Preview) (PreviewState, bool, error)
+}
+
+// RepoPreviews is implemented by provisioners that can list the previews of
+// a repository, so they are torn down when the app leaves it. Destroy is
+// then called without a client, as the app no longer has access to the
+// repository.
+type RepoPreviews interface {
+	// Previews returns the numbers of the pull requests with a preview.
+	Previews(ctx context.Context, owner, repo string) ([]int, error)
+}
+
+// MemoryProvisioner keeps track of previews in process memory without
+// building anything, for tests and local development.
+type MemoryProvisioner struct {
+	mu       sync.Mutex
+	previews map[string]PreviewState
+	now      func() time.Time
+}
+
+func NewMemoryProvisioner() *MemoryProvisioner {
+	return &MemoryProvisioner{
+		previews: make(map[string]PreviewState),
+		now:      time.Now,
+	}
+}
+
+func (p *MemoryProvisioner) Deploy(ctx context.Context, client *github.Client, preview Preview) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.previews[preview.Key()] = PreviewState{
+		HeadSHA:   preview.HeadSHA,
+		URL:       preview.URL,
+		UpdatedAt: p.now(),
+	}
+	return nil
+}
+
+func (p *MemoryProvisioner) Destroy(ctx context.Context, client *github.Client, preview Preview) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.previews, preview.Key())
+	return nil
+}
+
+func (p *MemoryProvisioner) Previews(ctx context.Context, owner, repo string) ([]int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// keys are "owner/repo#number", see Preview.Key.
+	prefix := fmt.Sprintf("%s/%s#", strings.ToLower(owner), strings.ToLower(repo))
+	var numbers []int
+	for key := range p.previews {
+		if number, err := strconv.Atoi(strings.TrimPrefix(key, prefix)); err == nil && strings.HasPrefix(key, prefix) {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+func (p *MemoryProvisioner) Status(ctx context.Context, client *github.Client, preview Preview) (PreviewState, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state, ok := p.previews[preview.Key()]
+	return state, ok, nil
+}
@@ -0,0 +1,96 @@
+package business
+
+import (
+	"context"
+	"errors"
+	"github.com/google/go-github/v47/github"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type failingProvisioner struct {
+	MemoryProvisioner
+	err error
+}
+
+func (p *failingProvisioner) Deploy(ctx context.Context, client *github.Client, preview Preview) error {
+	return p.err
+}
+
+func TestPublishPreview_Provisioner(t *testing.T) {
+	ctx := context.Background()
+	var created []github.CreateCheckRunOptions
+	var updated []github.UpdateCheckRunOptions
+	var comments int
+	client := checksClient(t, github.PullRequest{}, &created, &updated, &comments, false)
+	provisioner := NewMemoryProvisioner()
+	event := stickyEvent("0123456789abcdef")
+	preview := newPreview(event, "https://pr-10.example.com")
+
+	assert.NoError(t, publishPreview(ctx, client, provisioner, nil, &Checks{}, event, preview.URL, "preview your site"))
+	state, ok, err := provisioner.Status(ctx, client, preview)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "0123456789abcdef", state.HeadSHA)
+	assert.Equal(t, "https://pr-10.example.com", state.URL)
+	assert.Equal(t, 1, comments)
+
+	assert.NoError(t, retirePreview(ctx, client, provisioner, nil, nil, event, preview.URL, "your site has been cleaned up"))
+	_, ok, err = provisioner.Status(ctx, client, preview)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestPublishPreview_ProvisionerError(t *testing.T) {
+	var created []github.CreateCheckRunOptions
+	var updated []github.UpdateCheckRunOptions
+	var comments int
+	client := checksClient(t, github.PullRequest{}, &created, &updated, &comments, false)
+	provisioner := &failingProvisioner{err: errors.New("build failed")}
+	err := publishPreview(context.Background(), client, provisioner, nil, &Checks{}, stickyEvent("0123456789abcdef"), "https://pr-10.example.com", "preview your site")
+	assert.EqualError(t, err, "build failed")
+	assert.Zero(t, comments, "the comment keeps the last good state")
+	if assert.Len(t, updated, 1) {
+		assert.Equal(t, "failure", updated[0].GetConclusion())
+	}
+}
+
+func TestCommandHandler_status(t *testing.T) {
+	ctx := context.Background()
+	event := stickyEvent("0123456789abcdef")
+	event.PullRequest.State = stringRef("open")
+	tests := []struct {
+		name     string
+		deployed string
+		want     string
+	}{
+		{
+			name: "not deployed",
+			want: "no preview: it has not been deployed yet",
+		},
+		{
+			name:     "latest commit deployed",
+			deployed: "0123456789abcdef",
+			want:     "preview for 0123456 is live at: http://example.com/site",
+		},
+		{
+			name:     "older commit deployed",
+			deployed: "fedcba9876543210",
+			want:     "preview for fedcba9 is live at: http://example.com/site\n\nthe latest commit 0123456 is not deployed yet",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provisioner := NewMemoryProvisioner()
+			if tt.deployed != "" {
+				deployed := newPreview(event, previewURL)
+				deployed.HeadSHA = tt.deployed
+				assert.NoError(t, provisioner.Deploy(ctx, nil, deployed))
+			}
+			h := &CommandHandler{Provisioner: provisioner}
+			got, err := h.status(ctx, nil, event)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
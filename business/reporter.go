@@ -0,0 +1,181 @@
+package business
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"github.com/rs/zerolog"
+)
+
+// Reporter shows the outcome of a preview build on the pull request head.
+// The preview comment is not a Reporter: it is what every installation gets,
+// needing only the pull request permissions the app is installed with, and
+// it also carries the deployment history and teardown messages, which have
+// no place on a commit. Reporters come on top of it.
+type Reporter interface {
+	// Start reports that the preview of the pull request head is being
+	// built.
+	Start(ctx context.Context, client *github.Client, event github.PullRequestEvent) (Report, error)
+	// Retire reports that the preview of the pull request was removed, so
+	// the head no longer links to it.
+	Retire(ctx context.Context, client *github.Client, event github.PullRequestEvent) error
+}
+
+// Report is a build started by a Reporter.
+type Report interface {
+	// Succeed reports the preview live at previewURL.
+	Succeed(ctx context.Context, previewURL string) error
+	// Fail reports the build failed and returns cause.
+	Fail(ctx context.Context, cause error) error
+}
+
+// startReport starts a report through reporter, which may be nil.
+func startReport(ctx context.Context, client *github.Client, reporter Reporter, event github.PullRequestEvent) (Report, error) {
+	if reporter == nil {
+		return noReport{}, nil
+	}
+	return reporter.Start(ctx, client, event)
+}
+
+// retireReport retires the preview through reporter, which may be nil.
+func retireReport(ctx context.Context, client *github.Client, reporter Reporter, event github.PullRequestEvent) error {
+	if reporter == nil {
+		return nil
+	}
+	return reporter.Retire(ctx, client, event)
+}
+
+// noReport reports nothing.
+type noReport struct{}
+
+func (noReport) Succeed(ctx context.Context, previewURL string) error {
+	return nil
+}
+
+func (noReport) Fail(ctx context.Context, cause error) error {
+	return cause
+}
+
+// StatusContext names the commit status reporting the preview. It matches
+// CheckRunName, so a branch protection rule requiring "Preview" is met by
+// either.
+const StatusContext = CheckRunName
+
+// Statuses reports previews as commit statuses on the pull request head, for
+// installations that cannot create check runs. A nil Statuses reports
+// nothing.
+type Statuses struct{}
+
+func (s *Statuses) Start(ctx context.Context, client *github.Client, event github.PullRequestEvent) (Report, error) {
+	if s == nil {
+		return noReport{}, nil
+	}
+	r := &StatusReport{
+		client: client,
+		owner:  event.GetRepo().GetOwner().GetLogin(),
+		repo:   event.GetRepo().GetName(),
+		sha:    event.GetPullRequest().GetHead().GetSHA(),
+	}
+	if err := r.create(ctx, "pending", "Deploying preview", ""); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Retire marks the status successful without a link, as commit statuses
+// have no neutral state.
+func (s *Statuses) Retire(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	if s == nil {
+		return nil
+	}
+	r := &StatusReport{
+		client: client,
+		owner:  event.GetRepo().GetOwner().GetLogin(),
+		repo:   event.GetRepo().GetName(),
+		sha:    event.GetPullRequest().GetHead().GetSHA(),
+	}
+	return r.create(ctx, "success", "Preview removed", "")
+}
+
+// StatusReport is a commit status created by Statuses.
+type StatusReport struct {
+	client *github.Client
+	owner  string
+	repo   string
+	sha    string
+}
+
+// Succeed marks the status successful, linking to the preview.
+func (r *StatusReport) Succeed(ctx context.Context, previewURL string) error {
+	return r.create(ctx, "success", "Preview is live", previewURL)
+}
+
+// Fail marks the status failed and returns cause. Failing to report the
+// failure is only logged.
+func (r *StatusReport) Fail(ctx context.Context, cause error) error {
+	if err := r.create(ctx, "failure", cause.Error(), ""); err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("failed to report commit status failure")
+	}
+	return cause
+}
+
+func (r *StatusReport) create(ctx context.Context, state, description, targetURL string) error {
+	status := &github.RepoStatus{
+		State:       github.String(state),
+		Context:     github.String(StatusContext),
+		Description: github.String(truncateDescription(description)),
+	}
+	if targetURL != "" {
+		status.TargetURL = github.String(targetURL)
+	}
+	_, _, err := r.client.Repositories.CreateStatus(ctx, r.owner, r.repo, r.sha, status)
+	return err
+}
+
+// InstallationPermissions looks up the permissions an installation granted
+// the app.
+type InstallationPermissions interface {
+	Permissions(ctx context.Context, installationID int64) (*github.InstallationPermissions, error)
+}
+
+// AutoReporter reports through check runs when the installation lets the app
+// write checks, and through commit statuses when it only lets it write
+// statuses. Builds are not reported when neither is granted. Deployments
+// check the same permissions, so an installation granting only statuses
+// gets a commit status and no deployment.
+type AutoReporter struct {
+	Permissions InstallationPermissions
+	Checks      *Checks
+	Statuses    *Statuses
+}
+
+func (r *AutoReporter) Start(ctx context.Context, client *github.Client, event github.PullRequestEvent) (Report, error) {
+	reporter, err := r.pick(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	return startReport(ctx, client, reporter, event)
+}
+
+func (r *AutoReporter) Retire(ctx context.Context, client *github.Client, event github.PullRequestEvent) error {
+	reporter, err := r.pick(ctx, event)
+	if err != nil {
+		return err
+	}
+	return retireReport(ctx, client, reporter, event)
+}
+
+// pick returns the reporter the event's installation allows, or nil.
+func (r *AutoReporter) pick(ctx context.Context, event github.PullRequestEvent) (Reporter, error) {
+	perms, err := r.Permissions.Permissions(ctx, event.GetInstallation().GetID())
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case perms.GetChecks() == "write":
+		return r.Checks, nil
+	case perms.GetStatuses() == "write":
+		return r.Statuses, nil
+	}
+	zerolog.Ctx(ctx).Debug().Msg("installation grants neither checks nor statuses, not reporting the build")
+	return nil, nil
+}
@@ -0,0 +1,138 @@
+package business
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/go-github/v47/github"
+	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"testing"
+)
+
+type fakePermissions struct {
+	permissions *github.InstallationPermissions
+	err         error
+}
+
+func (p fakePermissions) Permissions(ctx context.Context, installationID int64) (*github.InstallationPermissions, error) {
+	return p.permissions, p.err
+}
+
+// reporterClient records the check runs and commit statuses created. It
+// serves the preview comment, and fails the test on deployments.
+func reporterClient(t *testing.T, checks *int, statuses *[]github.RepoStatus) *github.Client {
+	return github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatchHandler(mock.PostReposDeploymentsByOwnerByRepo, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("unexpected deployment")
+			w.WriteHeader(http.StatusForbidden)
+		})),
+		mock.WithRequestMatchHandler(mock.GetReposIssuesCommentsByOwnerByRepoByIssueNumber, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(mock.MustMarshal([]github.IssueComment{}))
+		})),
+		mock.WithRequestMatch(mock.PostReposIssuesCommentsByOwnerByRepoByIssueNumber, github.IssueComment{}),
+		mock.WithRequestMatchHandler(mock.PostReposCheckRunsByOwnerByRepo, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*checks++
+			w.Write(mock.MustMarshal(github.CheckRun{ID: github.Int64(7)}))
+		})),
+		mock.WithRequestMatch(mock.PatchReposCheckRunsByOwnerByRepoByCheckRunId, github.CheckRun{ID: github.Int64(7)}),
+		mock.WithRequestMatchHandler(mock.PostReposStatusesByOwnerByRepoBySha, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var s github.RepoStatus
+			b, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			assert.NoError(t, json.Unmarshal(b, &s))
+			*statuses = append(*statuses, s)
+			w.Write(mock.MustMarshal(s))
+		})),
+	))
+}
+
+func TestAutoReporter_Start(t *testing.T) {
+	tests := []struct {
+		name         string
+		permissions  fakePermissions
+		wantErr      bool
+		wantChecks   int
+		wantStatuses int
+	}{
+		{
+			name:        "checks permission",
+			permissions: fakePermissions{permissions: &github.InstallationPermissions{Checks: stringRef("write"), Statuses: stringRef("write")}},
+			wantChecks:  1,
+		},
+		{
+			name:         "statuses permission only",
+			permissions:  fakePermissions{permissions: &github.InstallationPermissions{Checks: stringRef("read"), Statuses: stringRef("write")}},
+			wantStatuses: 1,
+		},
+		{
+			name:        "neither permission",
+			permissions: fakePermissions{permissions: &github.InstallationPermissions{}},
+		},
+		{
+			name:        "permission lookup error",
+			permissions: fakePermissions{err: errors.New("bad credentials")},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var checks int
+			var statuses []github.RepoStatus
+			client := reporterClient(t, &checks, &statuses)
+			r := &AutoReporter{Permissions: tt.permissions, Checks: &Checks{}, Statuses: &Statuses{}}
+			report, err := r.Start(context.Background(), client, stickyEvent("0123456789abcdef"))
+			assert.Equal(t, tt.wantErr, err != nil)
+			if err == nil {
+				assert.NoError(t, report.Succeed(context.Background(), "https://pr-10.example.com"))
+			}
+			assert.Equal(t, tt.wantChecks, checks)
+			// a pending status, then a successful one.
+			assert.Len(t, statuses, 2*tt.wantStatuses)
+		})
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	var checks int
+	var statuses []github.RepoStatus
+	client := reporterClient(t, &checks, &statuses)
+	event := stickyEvent("0123456789abcdef")
+	report, err := (&Statuses{}).Start(context.Background(), client, event)
+	assert.NoError(t, err)
+	assert.NoError(t, report.Succeed(context.Background(), "https://pr-10.example.com"))
+	report, err = (&Statuses{}).Start(context.Background(), client, event)
+	assert.NoError(t, err)
+	cause := errors.New("build failed")
+	assert.Equal(t, cause, report.Fail(context.Background(), cause))
+	assert.NoError(t, (&Statuses{}).Retire(context.Background(), client, event))
+
+	if assert.Len(t, statuses, 5) {
+		assert.Equal(t, "pending", statuses[0].GetState())
+		assert.Equal(t, StatusContext, statuses[0].GetContext())
+		assert.Equal(t, "success", statuses[1].GetState())
+		assert.Equal(t, "https://pr-10.example.com", statuses[1].GetTargetURL())
+		assert.Equal(t, "failure", statuses[3].GetState())
+		assert.Equal(t, "build failed", statuses[3].GetDescription())
+		assert.Equal(t, "success", statuses[4].GetState())
+		assert.Empty(t, statuses[4].GetTargetURL())
+	}
+}
+
+func TestPublishPreview_statusesOnly(t *testing.T) {
+	var checks int
+	var statuses []github.RepoStatus
+	client := reporterClient(t, &checks, &statuses)
+	perms := fakePermissions{permissions: &github.InstallationPermissions{Statuses: stringRef("write")}}
+	deployments := &Deployments{Permissions: perms}
+	reporter := &AutoReporter{Permissions: perms, Checks: &Checks{}, Statuses: &Statuses{}}
+
+	err := publishPreview(context.Background(), client, nil, deployments, reporter, stickyEvent("0123456789abcdef"), "https://pr-10.example.com", "preview your site")
+	assert.NoError(t, err)
+	assert.Zero(t, checks)
+	if assert.Len(t, statuses, 2) {
+		assert.Equal(t, "success", statuses[1].GetState())
+	}
+}
@@ -0,0 +1,154 @@
+package business
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"strings"
+	"time"
+)
+
+const (
+	// stickyMarker identifies the app's preview comment on a pull request.
+	stickyMarker = "<!-- gh-app-pr-hello:preview -->"
+	// historyMarker prefixes the machine readable deployment history kept at
+	// the end of the preview comment.
+	historyMarker = "<!-- gh-app-pr-hello:history "
+	maxHistory    = 20
+)
+
+// Deployment is one entry of the preview comment's history: the latest
+// preview state reported for a commit.
+type Deployment struct {
+	SHA     string    `json:"sha"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+// updatePreviewComment shows msg in the pull request's preview comment,
+// creating the comment the first time and editing it afterwards, and records
+// msg in the comment's deployment history for the head commit.
+func updatePreviewComment(ctx context.Context, client *github.Client, event github.PullRequestEvent, msg string) error {
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	number := event.GetNumber()
+	existing, err := findPreviewComment(ctx, client, owner, repo, number)
+	if err != nil {
+		return err
+	}
+
+	var history []Deployment
+	if existing != nil {
+		history = parseHistory(existing.GetBody())
+	}
+	history = recordDeployment(history, Deployment{
+		SHA:     event.GetPullRequest().GetHead().GetSHA(),
+		Message: msg,
+		At:      time.Now().UTC(),
+	})
+	body := renderPreviewComment(msg, history)
+
+	if existing == nil {
+		_, _, err = client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{Body: &body})
+		return err
+	}
+	if existing.GetBody() == body {
+		return nil
+	}
+	_, _, err = client.Issues.EditComment(ctx, owner, repo, existing.GetID(), &github.IssueComment{Body: &body})
+	return err
+}
+
+// findPreviewComment returns the pull request's preview comment, or nil if
+// there is none yet.
+func findPreviewComment(ctx context.Context, client *github.Client, owner, repo string, number int) (*github.IssueComment, error) {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := client.Issues.ListComments(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range comments {
+			if isPreviewComment(c) {
+				return c, nil
+			}
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// isPreviewComment reports whether c is a preview comment written by an app.
+// Quoting the comment in a reply does not keep the marker first, and people
+// copying the marker into their own comments are not Bot users; only apps
+// installed on the repository comment as one.
+func isPreviewComment(c *github.IssueComment) bool {
+	return c.GetUser().GetType() == "Bot" && strings.HasPrefix(c.GetBody(), stickyMarker)
+}
+
+// recordDeployment replaces the entry for d's commit, or adds one, keeping
+// the newest entries first.
+func recordDeployment(history []Deployment, d Deployment) []Deployment {
+	updated := []Deployment{d}
+	for _, h := range history {
+		if h.SHA != d.SHA {
+			updated = append(updated, h)
+		}
+	}
+	if len(updated) > maxHistory {
+		updated = updated[:maxHistory]
+	}
+	return updated
+}
+
+func renderPreviewComment(msg string, history []Deployment) string {
+	var b strings.Builder
+	b.WriteString(stickyMarker + "\n")
+	b.WriteString(msg + "\n")
+	if len(history) > 0 {
+		b.WriteString("\n<details><summary>Deployment history</summary>\n\n")
+		b.WriteString("| Commit | Status | Updated |\n|---|---|---|\n")
+		for _, d := range history {
+			sha := shortSHA(d.SHA)
+			if sha == "" {
+				sha = "-"
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", sha, tableCell(d.Message), d.At.Format(time.RFC3339))
+		}
+		b.WriteString("\n</details>\n")
+	}
+	// the history is base64 encoded so that no message can end the comment.
+	encoded, _ := json.Marshal(history)
+	b.WriteString(historyMarker + base64.StdEncoding.EncodeToString(encoded) + " -->")
+	return b.String()
+}
+
+// parseHistory reads the deployment history back from a preview comment.
+// Unreadable history is dropped rather than failing the update.
+func parseHistory(body string) []Deployment {
+	i := strings.LastIndex(body, historyMarker)
+	if i < 0 {
+		return nil
+	}
+	encoded := strings.TrimSuffix(strings.TrimSpace(body[i+len(historyMarker):]), "-->")
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil
+	}
+	var history []Deployment
+	if err := json.Unmarshal(raw, &history); err != nil {
+		return nil
+	}
+	return history
+}
+
+// tableCell flattens a message so it fits in a Markdown table cell.
+func tableCell(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", " ")
+	s = strings.ReplaceAll(s, "\n", " ")
+	return strings.ReplaceAll(s, "|", "\\|")
+}
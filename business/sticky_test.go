@@ -0,0 +1,129 @@
+package business
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stickyClient serves the given pages of comments and records the bodies
+// of created and edited comments.
+func stickyClient(t *testing.T, created, edited *[]string, pages ...[]github.IssueComment) *github.Client {
+	record := func(bodies *[]string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var c github.IssueComment
+			b, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			assert.NoError(t, json.Unmarshal(b, &c))
+			*bodies = append(*bodies, c.GetBody())
+			w.Write(mock.MustMarshal(c))
+		}
+	}
+	listed := make([]interface{}, len(pages))
+	for i, p := range pages {
+		listed[i] = p
+	}
+	return github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatchPages(mock.GetReposIssuesCommentsByOwnerByRepoByIssueNumber, listed...),
+		mock.WithRequestMatchHandler(mock.PostReposIssuesCommentsByOwnerByRepoByIssueNumber, record(created)),
+		mock.WithRequestMatchHandler(mock.PatchReposIssuesCommentsByOwnerByRepoByCommentId, record(edited)),
+	))
+}
+
+func stickyEvent(sha string) github.PullRequestEvent {
+	event := testPullRequestEvent("synchronize")
+	event.PullRequest.Head = &github.PullRequestBranch{SHA: stringRef(sha)}
+	return event
+}
+
+func TestUpdatePreviewComment(t *testing.T) {
+	ctx := context.Background()
+	previous := renderPreviewComment("old", []Deployment{
+		{SHA: "1111111aaaa", Message: "old", At: time.Now()},
+	})
+	app := &github.User{Login: stringRef("gh-app-pr-hello[bot]"), Type: stringRef("Bot")}
+	person := &github.User{Login: stringRef("mallory"), Type: stringRef("User")}
+	tests := []struct {
+		name        string
+		pages       [][]github.IssueComment
+		wantCreated int
+		wantEdited  int
+		wantHistory []string
+	}{
+		{
+			name:        "creates the comment",
+			pages:       [][]github.IssueComment{{{ID: github.Int64(1), Body: stringRef("lgtm")}}},
+			wantCreated: 1,
+			wantHistory: []string{"2222222bbbb"},
+		},
+		{
+			name: "edits the comment found on a later page",
+			pages: [][]github.IssueComment{
+				{{ID: github.Int64(1), Body: stringRef("> " + previous), User: app}},
+				{{ID: github.Int64(2), Body: &previous, User: app}},
+			},
+			wantEdited:  1,
+			wantHistory: []string{"2222222bbbb", "1111111aaaa"},
+		},
+		{
+			name:        "ignores the marker in a person's comment",
+			pages:       [][]github.IssueComment{{{ID: github.Int64(1), Body: &previous, User: person}}},
+			wantCreated: 1,
+			wantHistory: []string{"2222222bbbb"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created, edited []string
+			client := stickyClient(t, &created, &edited, tt.pages...)
+			err := updatePreviewComment(ctx, client, stickyEvent("2222222bbbb"), "preview updated")
+			assert.NoError(t, err)
+			assert.Len(t, created, tt.wantCreated)
+			assert.Len(t, edited, tt.wantEdited)
+
+			body := strings.Join(append(created, edited...), "")
+			assert.True(t, strings.HasPrefix(body, stickyMarker+"\npreview updated\n"))
+			var shas []string
+			for _, d := range parseHistory(body) {
+				shas = append(shas, d.SHA)
+			}
+			assert.Equal(t, tt.wantHistory, shas)
+		})
+	}
+}
+
+func TestRecordDeployment(t *testing.T) {
+	var history []Deployment
+	for i := 0; i < maxHistory+5; i++ {
+		history = recordDeployment(history, Deployment{SHA: fmt.Sprint(i), Message: "deployed"})
+	}
+	assert.Len(t, history, maxHistory)
+	assert.Equal(t, fmt.Sprint(maxHistory+4), history[0].SHA, "newest first")
+
+	history = recordDeployment(history, Deployment{SHA: "10", Message: "redeployed"})
+	assert.Len(t, history, maxHistory)
+	assert.Equal(t, "redeployed", history[0].Message, "one entry per commit")
+	for _, d := range history[1:] {
+		assert.NotEqual(t, "10", d.SHA)
+	}
+}
+
+func TestParseHistory(t *testing.T) {
+	history := []Deployment{
+		{SHA: "abc", Message: "a | b\nc -->", At: time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	body := renderPreviewComment("msg", history)
+	assert.Contains(t, body, "| `abc` | a \\| b c --> | 2022-01-02T03:04:05Z |")
+	assert.Equal(t, history, parseHistory(body))
+
+	assert.Nil(t, parseHistory("no history"))
+	assert.Nil(t, parseHistory(historyMarker+"not base64 -->"))
+}
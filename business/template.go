@@ -0,0 +1,236 @@
+package business
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"github.com/palantir/go-githubapp/appconfig"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Names of the preview comment templates.
+const (
+	TemplateDeployed    = "deployed"
+	TemplateRefreshed   = "refreshed"
+	TemplateBaseChanged = "base_changed"
+	TemplateRestored    = "restored"
+	TemplateDestroyed   = "destroyed"
+	TemplateShipped     = "shipped"
+	TemplateDrafted     = "drafted"
+	TemplateLabeled     = "labeled"
+)
+
+// DefaultTemplates are the built-in Markdown templates for the preview
+// comment, keyed by name.
+var DefaultTemplates = map[string]string{
+	TemplateDeployed:    "preview your site at: {{.PreviewURL}}",
+	TemplateRefreshed:   "preview refreshed for {{.ShortSHA}} at: {{.PreviewURL}}",
+	TemplateBaseChanged: "base branch changed to {{.BaseBranch}}, preview refreshed at: {{.PreviewURL}}",
+	TemplateRestored:    "your site has been restored at: {{.PreviewURL}}",
+	TemplateDestroyed:   "your site has been cleaned up",
+	TemplateShipped:     "shipped in {{.ShortMergeSHA}}, your site has been cleaned up",
+	TemplateDrafted:     "your site has been cleaned up while this pull request is a draft",
+	TemplateLabeled:     "your site has been cleaned up because of the {{.Label}} label",
+}
+
+// CommentData is what comment templates can refer to.
+type CommentData struct {
+	Number     int
+	Title      string
+	Author     string
+	HeadSHA    string
+	ShortSHA   string
+	Branch     string
+	BaseBranch string
+	// Repo is the repository in "owner/name" form.
+	Repo       string
+	Owner      string
+	RepoName   string
+	PreviewURL string
+	// Label is the label added or removed by the event, if any.
+	Label string
+	// MergeSHA is the merge commit of a merged pull request.
+	MergeSHA      string
+	ShortMergeSHA string
+}
+
+// newCommentData collects the template data for a pull request event.
+func newCommentData(event github.PullRequestEvent, previewURL string) CommentData {
+	pr := event.GetPullRequest()
+	repo := event.GetRepo()
+	fullName := repo.GetFullName()
+	if fullName == "" {
+		fullName = repo.GetOwner().GetLogin() + "/" + repo.GetName()
+	}
+	return CommentData{
+		Number:     event.GetNumber(),
+		Title:      pr.GetTitle(),
+		Author:     pr.GetUser().GetLogin(),
+		HeadSHA:    pr.GetHead().GetSHA(),
+		ShortSHA:   shortSHA(pr.GetHead().GetSHA()),
+		Branch:     pr.GetHead().GetRef(),
+		BaseBranch: pr.GetBase().GetRef(),
+		Repo:       fullName,
+		Owner:      repo.GetOwner().GetLogin(),
+		RepoName:   repo.GetName(),
+		PreviewURL: previewURL,
+		Label:      event.GetLabel().GetName(),
+
+		MergeSHA:      pr.GetMergeCommitSHA(),
+		ShortMergeSHA: shortSHA(pr.GetMergeCommitSHA()),
+	}
+}
+
+// sampleCommentData is used to check that templates render.
+var sampleCommentData = CommentData{
+	Number:     1,
+	Title:      "Add a feature",
+	Author:     "octocat",
+	HeadSHA:    "0123456789abcdef0123456789abcdef01234567",
+	ShortSHA:   "0123456",
+	Branch:     "feature",
+	BaseBranch: "main",
+	Repo:       "octocat/hello-world",
+	Owner:      "octocat",
+	RepoName:   "hello-world",
+	PreviewURL: previewURL,
+	Label:      NoPreviewLabel,
+
+	MergeSHA:      "fedcba9876543210fedcba9876543210fedcba98",
+	ShortMergeSHA: "fedcba9",
+}
+
+// Templates is a validated set of comment templates.
+type Templates struct {
+	t *template.Template
+}
+
+var builtinTemplates = mustParseBuiltinTemplates()
+
+func mustParseBuiltinTemplates() *Templates {
+	t, err := parseTemplates(template.New("comment").Option("missingkey=error"), DefaultTemplates)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// ParseTemplates overrides the templates in base, or the built-in ones when
+// base is nil, with sources keyed by template name. Every template is
+// rendered once against sample data, so unknown names, syntax errors and
+// references to missing fields are reported here rather than when a comment
+// is posted.
+func ParseTemplates(base *Templates, sources map[string]string) (*Templates, error) {
+	if base == nil {
+		base = builtinTemplates
+	}
+	t, err := base.t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return parseTemplates(t, sources)
+}
+
+func parseTemplates(t *template.Template, sources map[string]string) (*Templates, error) {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := DefaultTemplates[name]; !ok {
+			return nil, fmt.Errorf("unknown comment template %q", name)
+		}
+		if _, err := t.New(name).Parse(sources[name]); err != nil {
+			return nil, fmt.Errorf("comment template %q: %w", name, err)
+		}
+	}
+	for _, name := range names {
+		if err := t.ExecuteTemplate(io.Discard, name, sampleCommentData); err != nil {
+			return nil, fmt.Errorf("comment template %q: %w", name, err)
+		}
+	}
+	return &Templates{t: t}, nil
+}
+
+// Render executes the named template. A nil Templates uses the built-in
+// templates.
+func (t *Templates) Render(name string, data CommentData) (string, error) {
+	if t == nil {
+		t = builtinTemplates
+	}
+	var b bytes.Buffer
+	if err := t.t.ExecuteTemplate(&b, name, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// RepoConfig is the app configuration a repository, or its organization's
+// .github repository, can provide.
+type RepoConfig struct {
+	// Templates override comment templates by name.
+	Templates map[string]string `yaml:"templates"`
+}
+
+// TemplateLoader resolves the comment templates for a repository: its own
+// app configuration, then the organization default, then the app-wide
+// templates.
+type TemplateLoader struct {
+	// Config finds the app configuration file. Repositories cannot override
+	// templates when it is nil.
+	Config *appconfig.Loader
+	// Defaults are the app-wide templates. The built-in templates are used
+	// when it is nil.
+	Defaults *Templates
+}
+
+// Load returns the templates for owner/repo. Invalid repository templates are
+// logged and ignored, so a typo never blocks previews.
+func (l *TemplateLoader) Load(ctx context.Context, client *github.Client, owner, repo string) (*Templates, error) {
+	if l == nil {
+		return nil, nil
+	}
+	if l.Config == nil {
+		return l.Defaults, nil
+	}
+	c, err := l.Config.LoadConfig(ctx, client, owner, repo, "")
+	if err != nil {
+		return nil, err
+	}
+	if c.IsUndefined() {
+		return l.Defaults, nil
+	}
+	logger := zerolog.Ctx(ctx).With().Str("config", c.Source+":"+c.Path).Logger()
+	var rc RepoConfig
+	if err := yaml.Unmarshal(c.Content, &rc); err != nil {
+		logger.Warn().Err(err).Msg("ignoring unreadable app configuration")
+		return l.Defaults, nil
+	}
+	if len(rc.Templates) == 0 {
+		return l.Defaults, nil
+	}
+	t, err := ParseTemplates(l.Defaults, rc.Templates)
+	if err != nil {
+		logger.Warn().Err(err).Msg("ignoring invalid comment templates")
+		return l.Defaults, nil
+	}
+	return t, nil
+}
+
+// Render renders the named template for the pull request event and its
+// preview URL. A nil TemplateLoader renders the built-in templates.
+func (l *TemplateLoader) Render(ctx context.Context, client *github.Client, event github.PullRequestEvent, name, previewURL string) (string, error) {
+	repo := event.GetRepo()
+	t, err := l.Load(ctx, client, repo.GetOwner().GetLogin(), repo.GetName())
+	if err != nil {
+		return "", err
+	}
+	return t.Render(name, newCommentData(event, previewURL))
+}
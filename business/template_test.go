@@ -0,0 +1,140 @@
+package business
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/google/go-github/v47/github"
+	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/palantir/go-githubapp/appconfig"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestParseTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "override",
+			sources: map[string]string{TemplateDeployed: "Preview of #{{.Number}} by @{{.Author}}: {{.PreviewURL}}"},
+		},
+		{
+			name:    "unknown template",
+			sources: map[string]string{"deploy": "hi"},
+			wantErr: true,
+		},
+		{
+			name:    "syntax error",
+			sources: map[string]string{TemplateDeployed: "{{.PreviewURL"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			sources: map[string]string{TemplateDeployed: "{{.PreviewUrl}}"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTemplates(nil, tt.sources)
+			assert.Equal(t, tt.wantErr, err != nil, err)
+		})
+	}
+}
+
+func TestTemplates_Render(t *testing.T) {
+	event := stickyEvent("0123456789abcdef")
+	event.PullRequest.User = &github.User{Login: stringRef("octocat")}
+	data := newCommentData(event, previewURL)
+
+	var builtin *Templates
+	msg, err := builtin.Render(TemplateRefreshed, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "preview refreshed for 0123456 at: http://example.com/site", msg)
+
+	templates, err := ParseTemplates(nil, map[string]string{TemplateRefreshed: "{{.Repo}}#{{.Number}} by {{.Author}}\n"})
+	assert.NoError(t, err)
+	msg, err = templates.Render(TemplateRefreshed, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo/bar#10 by octocat", msg)
+
+	msg, err = templates.Render(TemplateDestroyed, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "your site has been cleaned up", msg, "other templates keep their defaults")
+}
+
+// configClient serves content as the repository's app configuration, or
+// reports it missing when content is empty. The organization has no default.
+func configClient(content string) *github.Client {
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "Not Found"}`))
+	})
+	contents := notFound
+	if content != "" {
+		contents = func(w http.ResponseWriter, r *http.Request) {
+			w.Write(mock.MustMarshal(github.RepositoryContent{
+				Type:     stringRef("file"),
+				Encoding: stringRef("base64"),
+				Content:  stringRef(base64.StdEncoding.EncodeToString([]byte(content))),
+			}))
+		}
+	}
+	return github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatchHandler(mock.GetReposContentsByOwnerByRepoByPath, contents),
+		mock.WithRequestMatchHandler(mock.GetReposByOwnerByRepo, notFound),
+	))
+}
+
+func TestTemplateLoader_Render(t *testing.T) {
+	tests := []struct {
+		name    string
+		loader  *TemplateLoader
+		client  *github.Client
+		wantMsg string
+	}{
+		{
+			name:    "nil loader",
+			wantMsg: "preview your site at: http://example.com/site",
+		},
+		{
+			name:    "repository override",
+			loader:  &TemplateLoader{Config: appconfig.NewLoader([]string{DefaultConfigPath})},
+			client:  configClient("templates:\n  deployed: |\n    Preview for {{.Title}}: {{.PreviewURL}}\n"),
+			wantMsg: "Preview for test: http://example.com/site",
+		},
+		{
+			name:    "invalid repository override",
+			loader:  &TemplateLoader{Config: appconfig.NewLoader([]string{DefaultConfigPath})},
+			client:  configClient("templates:\n  deployed: \"{{.Nope}}\"\n"),
+			wantMsg: "preview your site at: http://example.com/site",
+		},
+		{
+			name: "app-wide defaults without repository config",
+			loader: &TemplateLoader{
+				Config:   appconfig.NewLoader([]string{DefaultConfigPath}),
+				Defaults: mustParse(t, map[string]string{TemplateDeployed: "site: {{.PreviewURL}}"}),
+			},
+			client:  configClient(""),
+			wantMsg: "site: http://example.com/site",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := testPullRequestEvent("opened")
+			event.PullRequest.Title = stringRef("test")
+			msg, err := tt.loader.Render(context.Background(), tt.client, event, TemplateDeployed, previewURL)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMsg, msg)
+		})
+	}
+}
+
+func mustParse(t *testing.T, sources map[string]string) *Templates {
+	templates, err := ParseTemplates(nil, sources)
+	assert.NoError(t, err)
+	return templates
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/ehenry2/gh-app-pr-hello/internal"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"os"
+)
+
+func main() {
+	// configure logger
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	log.Info().
+		Msg("worker lambda function starting. parsing config from environment")
+
+	// load configuration
+	ctx := context.Background()
+	config, err := internal.NewConfig(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to read config")
+		os.Exit(1)
+	}
+	log.Info().Msg("parsed config successfully")
+
+	// build the same handlers the webhook route uses
+	handlers, err := internal.NewEventHandlers(config)
+	if err != nil {
+		log.Err(err).Msg("failed to create event handlers")
+		os.Exit(1)
+	}
+	worker := &internal.SQSWorker{
+		Handler:     internal.NewRouter(handlers...),
+		MaxAttempts: config.WorkerMaxAttempts,
+	}
+	// the dead-letter directory does not survive the Lambda container, so
+	// without a bucket failed messages are left to the queue's redrive
+	// policy.
+	if config.S3Bucket != "" {
+		worker.DeadLetters, err = config.ToDeadLetterStore()
+		if err != nil {
+			log.Err(err).Msg("failed to create dead letter store")
+			os.Exit(1)
+		}
+	}
+
+	// start the lambda handler
+	log.Info().Msg("starting sqs worker handler")
+	lambda.Start(worker.Handle)
+}
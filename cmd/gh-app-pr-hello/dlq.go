@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ehenry2/gh-app-pr-hello/internal"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+const dlqUsage = `usage: gh-app-pr-hello dlq <command>
+
+commands:
+  list                     list failed deliveries
+  show <delivery-id>       print a failed delivery as JSON
+  redrive <delivery-id>... process failed deliveries again
+  redrive --all            process every failed delivery again`
+
+// runDLQ implements the dlq subcommands against the configured dead-letter
+// store.
+func runDLQ(ctx context.Context, config *internal.Config, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(dlqUsage)
+	}
+	store, err := config.ToDeadLetterStore()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		return listDeadLetters(ctx, store, out)
+	case "show":
+		if len(args) != 2 {
+			return errors.New(dlqUsage)
+		}
+		return showDeadLetter(ctx, store, args[1], out)
+	case "redrive":
+		if len(args) < 2 {
+			return errors.New(dlqUsage)
+		}
+		handlers, err := internal.NewEventHandlers(config)
+		if err != nil {
+			return err
+		}
+		return redriveDeadLetters(ctx, store, internal.NewRouter(handlers...), args[1:], out)
+	}
+	return errors.New(dlqUsage)
+}
+
+func listDeadLetters(ctx context.Context, store internal.DeadLetterStore, out io.Writer) error {
+	letters, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "DELIVERY\tEVENT\tATTEMPTS\tFAILED\tERROR")
+	for _, l := range letters {
+		var cause string
+		if len(l.Errors) > 0 {
+			cause = l.Errors[0]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", l.DeliveryID, l.EventType, l.Attempts, l.FailedAt.Format(time.RFC3339), cause)
+	}
+	return w.Flush()
+}
+
+func showDeadLetter(ctx context.Context, store internal.DeadLetterStore, deliveryID string, out io.Writer) error {
+	l, err := store.Get(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+func redriveDeadLetters(ctx context.Context, store internal.DeadLetterStore, router *internal.Router, ids []string, out io.Writer) error {
+	if len(ids) == 1 && ids[0] == "--all" {
+		letters, err := store.List(ctx)
+		if err != nil {
+			return err
+		}
+		ids = ids[:0]
+		for _, l := range letters {
+			ids = append(ids, l.DeliveryID)
+		}
+	}
+	var failed int
+	for _, id := range ids {
+		if err := internal.Redrive(ctx, store, router, id); err != nil {
+			failed++
+			fmt.Fprintf(out, "%s: failed: %v\n", id, err)
+			continue
+		}
+		fmt.Fprintf(out, "%s: ok\n", id)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d deliveries failed", failed, len(ids))
+	}
+	return nil
+}
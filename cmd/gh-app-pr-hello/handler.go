@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/ehenry2/gh-app-pr-hello/internal"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"net/http"
 	"os"
 )
 
@@ -23,18 +25,41 @@ func main() {
 		os.Exit(1)
 	}
 	log.Info().Msg("parsed config successfully")
-	githubAppConfig := config.ToGithubAppConfig()
+
+	// run dead-letter maintenance commands instead of serving requests
+	if len(os.Args) > 1 && os.Args[1] == "dlq" {
+		if err := runDLQ(ctx, config, os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// register routes
 	log.Info().Msg("registering routes")
-	if err := internal.RegisterGithubWebhookDispatcher(githubAppConfig); err != nil {
+	if err := internal.RegisterGithubWebhookDispatcher(config); err != nil {
 		log.Err(err).Msg("failed to load client creator")
 		os.Exit(1)
 	}
+	handler, err := internal.RegisterStaticSiteServer(config, http.DefaultServeMux)
+	if err != nil {
+		log.Err(err).Msg("failed to open static site store")
+		os.Exit(1)
+	}
 	internal.RegisterHealthCheck()
 	log.Info().Msg("routes registered successfully")
 
+	if config.Runtime == internal.ServerRuntime {
+		log.Info().Str("addr", config.ListenAddr).Msg("starting http server")
+		if err := http.ListenAndServe(config.ListenAddr, handler); err != nil {
+			log.Err(err).Msg("http server stopped")
+			os.Exit(1)
+		}
+		return
+	}
+
 	// start the lambda handler
 	log.Info().Msg("starting lambda handler")
-	lambda.Start(internal.AlbHandler{}.ProxyWithContext)
+	albHandler := &internal.AlbHandler{Handler: handler}
+	lambda.Start(albHandler.ProxyWithContext)
 }
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"github.com/google/go-github/v47/github"
+	"strings"
+)
+
+// InstallationPolicy restricts which installations, organizations and
+// repositories the app acts on, so rollouts on a shared GitHub Enterprise
+// Server can be staged. Deny rules take precedence over allow rules, and an
+// empty allow list allows everything. Organization and repository names are
+// compared case-insensitively; repositories are given as "owner/name".
+type InstallationPolicy struct {
+	AllowInstallations []int64
+	DenyInstallations  []int64
+	AllowOrgs          []string
+	DenyOrgs           []string
+	AllowRepos         []string
+	DenyRepos          []string
+}
+
+// Check returns why events for the installation and repository must be
+// ignored, or an empty string when they are allowed.
+func (p *InstallationPolicy) Check(installationID int64, repo *github.Repository) string {
+	if p == nil {
+		return ""
+	}
+	org := repo.GetOwner().GetLogin()
+	fullName := repo.GetFullName()
+	if fullName == "" && org != "" {
+		fullName = org + "/" + repo.GetName()
+	}
+	switch {
+	case containsID(p.DenyInstallations, installationID):
+		return "installation denied"
+	case containsFold(p.DenyOrgs, org):
+		return "organization denied"
+	case containsFold(p.DenyRepos, fullName):
+		return "repository denied"
+	case len(p.AllowInstallations) > 0 && !containsID(p.AllowInstallations, installationID):
+		return "installation not allowed"
+	case len(p.AllowOrgs) > 0 && !containsFold(p.AllowOrgs, org):
+		return "organization not allowed"
+	case len(p.AllowRepos) > 0 && !containsFold(p.AllowRepos, fullName):
+		return "repository not allowed"
+	}
+	return ""
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
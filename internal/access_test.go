@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"github.com/google/go-github/v47/github"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func testRepo(owner, name string) *github.Repository {
+	return &github.Repository{
+		Owner:    &github.User{Login: github.String(owner)},
+		Name:     github.String(name),
+		FullName: github.String(owner + "/" + name),
+	}
+}
+
+func TestInstallationPolicy_Check(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         *InstallationPolicy
+		installationID int64
+		repo           *github.Repository
+		wantAllowed    bool
+	}{
+		{
+			name:        "nil policy allows everything",
+			policy:      nil,
+			repo:        testRepo("acme", "web"),
+			wantAllowed: true,
+		},
+		{
+			name:        "empty policy allows everything",
+			policy:      &InstallationPolicy{},
+			repo:        testRepo("acme", "web"),
+			wantAllowed: true,
+		},
+		{
+			name:           "allowed installation",
+			policy:         &InstallationPolicy{AllowInstallations: []int64{1}},
+			installationID: 1,
+			repo:           testRepo("acme", "web"),
+			wantAllowed:    true,
+		},
+		{
+			name:           "installation not allowed",
+			policy:         &InstallationPolicy{AllowInstallations: []int64{1}},
+			installationID: 2,
+			repo:           testRepo("acme", "web"),
+		},
+		{
+			name:        "org allowed case-insensitively",
+			policy:      &InstallationPolicy{AllowOrgs: []string{"ACME"}},
+			repo:        testRepo("acme", "web"),
+			wantAllowed: true,
+		},
+		{
+			name:   "org not allowed",
+			policy: &InstallationPolicy{AllowOrgs: []string{"acme"}},
+			repo:   testRepo("initech", "web"),
+		},
+		{
+			name:   "deny wins over allow",
+			policy: &InstallationPolicy{AllowOrgs: []string{"acme"}, DenyRepos: []string{"acme/legacy"}},
+			repo:   testRepo("acme", "legacy"),
+		},
+		{
+			name:           "denied installation",
+			policy:         &InstallationPolicy{DenyInstallations: []int64{3}},
+			installationID: 3,
+			repo:           testRepo("acme", "web"),
+		},
+		{
+			name:        "repo allowed without full name",
+			policy:      &InstallationPolicy{AllowRepos: []string{"acme/web"}},
+			repo:        &github.Repository{Owner: &github.User{Login: github.String("acme")}, Name: github.String("web")},
+			wantAllowed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := tt.policy.Check(tt.installationID, tt.repo)
+			assert.Equal(t, tt.wantAllowed, reason == "", reason)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/google/go-github/v47/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+)
+
+// CheckRunHandler controls previews from the pull request's Checks tab.
+type CheckRunHandler struct {
+	ClientCreator   githubapp.ClientCreator
+	CheckRunHandler *business.CheckRunHandler
+	Policy          *InstallationPolicy
+	Locks           *PRLocks
+}
+
+func (h *CheckRunHandler) Handles() []string {
+	return []string{"check_run"}
+}
+
+func (h *CheckRunHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event github.CheckRunEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("delivery", deliveryID).Msg("failed to decode json")
+		return business.Permanent(err)
+	}
+	run := event.GetCheckRun()
+	if run.GetName() != business.CheckRunName {
+		return nil
+	}
+	switch event.GetAction() {
+	case business.RerequestedAction, business.RequestedAction:
+	default:
+		return nil
+	}
+
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	logger := zerolog.Ctx(ctx).With().
+		Str("delivery", deliveryID).
+		Str("action", event.GetAction()).
+		Str("repo", event.GetRepo().GetFullName()).
+		Str("sha", run.GetHeadSHA()).
+		Str("sender", event.GetSender().GetLogin()).
+		Int64("installation", installationID).
+		Logger()
+	ctx = logger.WithContext(ctx)
+	if reason := h.Policy.Check(installationID, event.GetRepo()); reason != "" {
+		logger.Info().Str("skip_reason", reason).Msg("ignoring event outside the installation policy")
+		return nil
+	}
+	if len(run.PullRequests) == 0 {
+		// GitHub leaves pull requests from forks out of check runs.
+		logger.Info().Msg("ignoring check run without pull requests")
+		return nil
+	}
+	logger.Info().Msg("handling check run event")
+
+	client, err := h.ClientCreator.NewInstallationClient(installationID)
+	if err != nil {
+		logger.Err(err).Msg("failed to create installation client")
+		return err
+	}
+	for _, pr := range run.PullRequests {
+		if err := h.handle(ctx, client, event, pr.GetNumber()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *CheckRunHandler) handle(ctx context.Context, client *github.Client, event github.CheckRunEvent, number int) error {
+	logger := zerolog.Ctx(ctx).With().Int("pr", number).Logger()
+	ctx = logger.WithContext(ctx)
+
+	ctx, unlock, err := h.Locks.Lock(ctx, event.GetRepo().GetFullName(), number)
+	if err != nil {
+		logger.Err(err).Msg("failed to lock pull request")
+		return err
+	}
+	defer unlock()
+	return h.CheckRunHandler.Handle(ctx, client, event, number)
+}
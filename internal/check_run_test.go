@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckRunHandler_Handles(t *testing.T) {
+	h := &CheckRunHandler{}
+	assert.Equal(t, []string{"check_run"}, h.Handles())
+}
+
+func TestCheckRunHandler_Handle(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "invalid json",
+			payload: `{"action":`,
+			wantErr: assert.Error,
+		},
+		{
+			name:    "completed check run",
+			payload: `{"action": "completed", "check_run": {"name": "Preview", "pull_requests": [{"number": 1}]}}`,
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "another check re-run",
+			payload: `{"action": "rerequested", "check_run": {"name": "lint", "pull_requests": [{"number": 1}]}}`,
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "re-run without pull requests",
+			payload: `{"action": "rerequested", "check_run": {"name": "Preview", "pull_requests": []}}`,
+			wantErr: assert.NoError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// no client creator is configured, so reaching the GitHub API would panic.
+			h := &CheckRunHandler{}
+			tt.wantErr(t, h.Handle(context.Background(), "check_run", "delivery", []byte(tt.payload)))
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/google/go-github/v47/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+)
+
+// IssueCommentHandler runs slash commands posted on pull requests.
+type IssueCommentHandler struct {
+	ClientCreator  githubapp.ClientCreator
+	CommandHandler *business.CommandHandler
+	Policy         *InstallationPolicy
+	Locks          *PRLocks
+}
+
+func (h *IssueCommentHandler) Handles() []string {
+	return []string{"issue_comment"}
+}
+
+func (h *IssueCommentHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event github.IssueCommentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("delivery", deliveryID).Msg("failed to decode json")
+		return business.Permanent(err)
+	}
+	if !event.GetIssue().IsPullRequest() {
+		return nil
+	}
+	cmd, ok := business.ParseCommand(event.GetComment().GetBody())
+	if !ok {
+		return nil
+	}
+
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	logger := zerolog.Ctx(ctx).With().
+		Str("delivery", deliveryID).
+		Str("action", event.GetAction()).
+		Str("repo", event.GetRepo().GetFullName()).
+		Int("pr", event.GetIssue().GetNumber()).
+		Str("sender", event.GetSender().GetLogin()).
+		Int64("installation", installationID).
+		Str("command", cmd.Name).
+		Logger()
+	ctx = logger.WithContext(ctx)
+	if reason := h.Policy.Check(installationID, event.GetRepo()); reason != "" {
+		logger.Info().Str("skip_reason", reason).Msg("ignoring event outside the installation policy")
+		return nil
+	}
+	logger.Info().Msg("handling slash command")
+
+	ctx, unlock, err := h.Locks.Lock(ctx, event.GetRepo().GetFullName(), event.GetIssue().GetNumber())
+	if err != nil {
+		logger.Err(err).Msg("failed to lock pull request")
+		return err
+	}
+	defer unlock()
+
+	client, err := h.ClientCreator.NewInstallationClient(installationID)
+	if err != nil {
+		logger.Err(err).Msg("failed to create installation client")
+		return err
+	}
+	return h.CommandHandler.Handle(ctx, client, event)
+}
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestIssueCommentHandler_Handles(t *testing.T) {
+	h := &IssueCommentHandler{}
+	assert.Equal(t, []string{"issue_comment"}, h.Handles())
+}
+
+func TestIssueCommentHandler_Handle(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "invalid json",
+			payload: `{"action":`,
+			wantErr: assert.Error,
+		},
+		{
+			name:    "comment on an issue",
+			payload: `{"action": "created", "issue": {"number": 1}, "comment": {"body": "/preview status"}}`,
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "comment without a command",
+			payload: `{"action": "created", "issue": {"number": 1, "pull_request": {}}, "comment": {"body": "lgtm"}}`,
+			wantErr: assert.NoError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// no client creator is configured, so reaching the GitHub API would panic.
+			h := &IssueCommentHandler{}
+			tt.wantErr(t, h.Handle(context.Background(), "issue_comment", "delivery", []byte(tt.payload)))
+		})
+	}
+}
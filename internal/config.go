@@ -4,9 +4,42 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/palantir/go-githubapp/appconfig"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/sethvargo/go-envconfig"
 	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	LambdaRuntime = "lambda"
+	ServerRuntime = "server"
+)
+
+// Provisioners creating preview sites.
+const (
+	NoProvisionerBackend     = "none"
+	MemoryProvisionerBackend = "memory"
+	StaticProvisionerBackend = "static"
+)
+
+// Ways of reporting preview builds.
+const (
+	AutoReporter     = "auto"
+	ChecksReporter   = "checks"
+	StatusesReporter = "statuses"
+	NoReporter       = "none"
 )
 
 type GithubAuthConfig struct {
@@ -21,6 +54,91 @@ type Config struct {
 	PrivateKeyBytes  []byte `env:"GITHUB_PRIVATE_KEY,required"`
 	GithubV3Endpoint string `env:"GITHUB_V3_ENDPOINT,required"`
 	PrivateKey       string
+
+	// slash command authorization.
+	CommandMinPermission string   `env:"COMMAND_MIN_PERMISSION,default=write"`
+	CommandTeams         []string `env:"COMMAND_TEAMS"`
+
+	// webhook delivery deduplication.
+	DedupeBackend string        `env:"DEDUPE_BACKEND,default=memory"`
+	DedupeLease   time.Duration `env:"DEDUPE_LEASE,default=15m"`
+	DedupeTTL     time.Duration `env:"DEDUPE_TTL,default=72h"`
+	DedupeDir     string        `env:"DEDUPE_DIR,default=/tmp/gh-app-pr-hello/deliveries"`
+
+	// DynamoDB table shared by the dynamodb backends.
+	DynamoDBTable string `env:"DYNAMODB_TABLE"`
+
+	// S3 bucket shared by the object stores, used instead of their local
+	// directories when set.
+	S3Bucket string `env:"S3_BUCKET"`
+
+	// runtime and background processing.
+	Runtime           string        `env:"RUNTIME,default=lambda"`
+	ListenAddr        string        `env:"LISTEN_ADDR,default=:8080"`
+	AsyncMode         bool          `env:"ASYNC_MODE,default=false"`
+	QueueBackend      string        `env:"QUEUE_BACKEND,default=memory"`
+	SQSQueueURL       string        `env:"SQS_QUEUE_URL"`
+	QueueSize         int           `env:"QUEUE_SIZE,default=100"`
+	WorkerConcurrency int           `env:"WORKER_CONCURRENCY,default=4"`
+	WorkerMaxAttempts int           `env:"WORKER_MAX_ATTEMPTS,default=5"`
+	WorkerBackoff     time.Duration `env:"WORKER_BACKOFF,default=1s"`
+	DeadLetterDir     string        `env:"DEAD_LETTER_DIR,default=/tmp/gh-app-pr-hello/dead-letters"`
+
+	// per pull request locking. LockWait defaults to syncLockWait or
+	// asyncLockWait.
+	LockBackend string        `env:"LOCK_BACKEND,default=memory"`
+	LockLease   time.Duration `env:"LOCK_LEASE,default=2m"`
+	LockWait    time.Duration `env:"LOCK_WAIT"`
+
+	// skip and cancel deployments of outdated pull request heads.
+	SupersedeStale   bool          `env:"SUPERSEDE_STALE,default=true"`
+	HeadStoreBackend string        `env:"HEAD_STORE_BACKEND,default=memory"`
+	HeadStoreTTL     time.Duration `env:"HEAD_STORE_TTL,default=720h"`
+
+	// pull request event filtering.
+	FilterSkipBots         bool     `env:"FILTER_SKIP_BOTS,default=true"`
+	FilterSkipForks        *bool    `env:"FILTER_SKIP_FORKS,noinit"`
+	FilterSkipDrafts       bool     `env:"FILTER_SKIP_DRAFTS,default=true"`
+	FilterSkipBaseBranches []string `env:"FILTER_SKIP_BASE_BRANCHES"`
+	FilterSkipLabels       []string `env:"FILTER_SKIP_LABELS"`
+	FilterSkipTitleMarker  string   `env:"FILTER_SKIP_TITLE_MARKER,default=[skip preview]"`
+
+	// installation allow and deny lists.
+	AllowInstallations []int64  `env:"ALLOW_INSTALLATIONS"`
+	DenyInstallations  []int64  `env:"DENY_INSTALLATIONS"`
+	AllowOrgs          []string `env:"ALLOW_ORGS"`
+	DenyOrgs           []string `env:"DENY_ORGS"`
+	AllowRepos         []string `env:"ALLOW_REPOS"`
+	DenyRepos          []string `env:"DENY_REPOS"`
+
+	// installation lifecycle.
+	RepoRegistryDir   string `env:"REPO_REGISTRY_DIR,default=/tmp/gh-app-pr-hello/repos"`
+	OnboardingEnabled bool   `env:"ONBOARDING_ENABLED,default=false"`
+	AppConfigPath     string `env:"APP_CONFIG_PATH,default=.github/preview.yml"`
+
+	// comment templates and preview URLs.
+	CommentTemplatesDir string `env:"COMMENT_TEMPLATES_DIR"`
+	PreviewURLPattern   string `env:"PREVIEW_URL_PATTERN,default=http://example.com/site"`
+
+	// provisioning of preview sites.
+	Provisioner        string `env:"PROVISIONER,default=none"`
+	StaticSiteDir      string `env:"STATIC_SITE_DIR,default=public"`
+	StaticSiteStoreDir string `env:"STATIC_SITE_STORE_DIR,default=/tmp/gh-app-pr-hello/sites"`
+	StaticSiteMaxBytes int64  `env:"STATIC_SITE_MAX_BYTES,default=104857600"`
+	StaticSiteHosts    string `env:"STATIC_SITE_HOSTS"`
+
+	// GitHub deployments of previews and reporting of their builds.
+	DeploymentsEnabled bool          `env:"DEPLOYMENTS_ENABLED,default=true"`
+	Reporter           string        `env:"REPORTER,default=auto"`
+	PermissionsTTL     time.Duration `env:"PERMISSIONS_TTL,default=10m"`
+
+	// promotion of merged pull requests.
+	MergeHookURL    string `env:"MERGE_HOOK_URL"`
+	MergeHookSecret string `env:"MERGE_HOOK_SECRET"`
+
+	// logging.
+	LogPayloads    bool     `env:"LOG_PAYLOADS,default=false"`
+	LogRedactPaths []string `env:"LOG_REDACT_PATHS"`
 }
 
 func (c *Config) ToGithubAppConfig() *githubapp.Config {
@@ -34,6 +152,333 @@ func (c *Config) ToGithubAppConfig() *githubapp.Config {
 	}
 }
 
+func (c *Config) ToPermissionChecker() (*business.PermissionChecker, error) {
+	perm, err := business.ParsePermission(c.CommandMinPermission)
+	if err != nil {
+		return nil, err
+	}
+	return &business.PermissionChecker{
+		MinPermission: perm,
+		Teams:         c.CommandTeams,
+	}, nil
+}
+
+func (c *Config) ToDedupeStore() (DedupeStore, error) {
+	switch c.DedupeBackend {
+	case MemoryDedupeBackend:
+		return NewMemoryDedupeStore(c.DedupeLease, c.DedupeTTL), nil
+	case FileDedupeBackend:
+		return NewFileDedupeStore(c.DedupeDir, c.DedupeLease, c.DedupeTTL)
+	case DynamoDBDedupeBackend:
+		table, err := c.ToDynamoTable()
+		if err != nil {
+			return nil, err
+		}
+		return NewDynamoDBDedupeStore(table, c.DedupeLease, c.DedupeTTL), nil
+	}
+	return nil, fmt.Errorf("unknown dedupe backend %q", c.DedupeBackend)
+}
+
+// ToDynamoTable connects to DynamoDBTable with the default AWS credentials.
+func (c *Config) ToDynamoTable() (DynamoTable, error) {
+	if c.DynamoDBTable == "" {
+		return nil, errors.New("DYNAMODB_TABLE is required by the dynamodb backends")
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return NewDynamoDBTable(dynamodb.NewFromConfig(cfg), c.DynamoDBTable), nil
+}
+
+const (
+	// syncLockWait leaves time to process a webhook within GitHub's 10
+	// second delivery timeout.
+	syncLockWait  = 5 * time.Second
+	asyncLockWait = 30 * time.Second
+)
+
+func (c *Config) ToPRLocks() (*PRLocks, error) {
+	var locker Locker
+	switch c.LockBackend {
+	case MemoryLockBackend:
+		locker = NewMemoryLocker()
+	case DynamoDBLockBackend:
+		table, err := c.ToDynamoTable()
+		if err != nil {
+			return nil, err
+		}
+		locker = NewDynamoDBLocker(table)
+	default:
+		return nil, fmt.Errorf("unknown lock backend %q", c.LockBackend)
+	}
+	wait := c.LockWait
+	if wait == 0 {
+		wait = syncLockWait
+		if c.AsyncMode {
+			wait = asyncLockWait
+		}
+	}
+	return &PRLocks{
+		Locker:       locker,
+		Lease:        c.LockLease,
+		Wait:         wait,
+		PollInterval: 250 * time.Millisecond,
+	}, nil
+}
+
+// ToSuperseder returns nil when stale heads are processed like any other.
+func (c *Config) ToSuperseder() (*Superseder, error) {
+	if !c.SupersedeStale {
+		return nil, nil
+	}
+	switch c.HeadStoreBackend {
+	case MemoryHeadStoreBackend:
+		return &Superseder{Heads: NewMemoryHeadStore(c.HeadStoreTTL)}, nil
+	case DynamoDBHeadStoreBackend:
+		table, err := c.ToDynamoTable()
+		if err != nil {
+			return nil, err
+		}
+		return &Superseder{Heads: NewDynamoDBHeadStore(table, c.HeadStoreTTL)}, nil
+	}
+	return nil, fmt.Errorf("unknown head store backend %q", c.HeadStoreBackend)
+}
+
+// ToEventFilter skips forks unless FILTER_SKIP_FORKS says otherwise when the
+// static provisioner is used, as it serves pull request content from the
+// app's own domain.
+func (c *Config) ToEventFilter() *business.EventFilter {
+	skipForks := c.Provisioner == StaticProvisionerBackend
+	if c.FilterSkipForks != nil {
+		skipForks = *c.FilterSkipForks
+	}
+	return &business.EventFilter{
+		SkipBots:         c.FilterSkipBots,
+		SkipForks:        skipForks,
+		SkipDrafts:       c.FilterSkipDrafts,
+		SkipBaseBranches: c.FilterSkipBaseBranches,
+		SkipLabels:       c.FilterSkipLabels,
+		SkipTitleMarker:  c.FilterSkipTitleMarker,
+	}
+}
+
+func (c *Config) ToInstallationPolicy() *InstallationPolicy {
+	return &InstallationPolicy{
+		AllowInstallations: c.AllowInstallations,
+		DenyInstallations:  c.DenyInstallations,
+		AllowOrgs:          c.AllowOrgs,
+		DenyOrgs:           c.DenyOrgs,
+		AllowRepos:         c.AllowRepos,
+		DenyRepos:          c.DenyRepos,
+	}
+}
+
+// RedactPaths returns the payload fields hidden when LogPayloads is set.
+func (c *Config) RedactPaths() []string {
+	if len(c.LogRedactPaths) > 0 {
+		return c.LogRedactPaths
+	}
+	return DefaultRedactPaths
+}
+
+// toObjectStore returns the prefix of S3Bucket when a bucket is configured,
+// or else the local directory dir.
+func (c *Config) toObjectStore(dir, prefix string) (ObjectStore, error) {
+	if c.S3Bucket == "" {
+		return NewLocalObjectStore(dir)
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &S3ObjectStore{Client: s3.NewFromConfig(cfg), Bucket: c.S3Bucket, Prefix: prefix}, nil
+}
+
+func (c *Config) ToDeadLetterStore() (DeadLetterStore, error) {
+	objects, err := c.toObjectStore(c.DeadLetterDir, "dead-letters/")
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectDeadLetterStore{Objects: objects}, nil
+}
+
+func (c *Config) ToRepoRegistry() (RepoRegistry, error) {
+	objects, err := c.toObjectStore(c.RepoRegistryDir, "repos/")
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectRepoRegistry{Objects: objects}, nil
+}
+
+// ToOnboardingHandler returns nil when onboarding pull requests are disabled.
+func (c *Config) ToOnboardingHandler() *business.OnboardingHandler {
+	if !c.OnboardingEnabled {
+		return nil
+	}
+	return &business.OnboardingHandler{ConfigPath: c.AppConfigPath}
+}
+
+// ToTemplateLoader reads the app-wide comment templates, one "<name>.md" file
+// per template in CommentTemplatesDir, on top of the built-in ones.
+func (c *Config) ToTemplateLoader() (*business.TemplateLoader, error) {
+	sources := make(map[string]string)
+	if c.CommentTemplatesDir != "" {
+		paths, err := filepath.Glob(filepath.Join(c.CommentTemplatesDir, "*.md"))
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range paths {
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return nil, err
+			}
+			sources[strings.TrimSuffix(filepath.Base(p), ".md")] = string(b)
+		}
+	}
+	defaults, err := business.ParseTemplates(nil, sources)
+	if err != nil {
+		return nil, err
+	}
+	return &business.TemplateLoader{
+		Config:   appconfig.NewLoader([]string{c.AppConfigPath}),
+		Defaults: defaults,
+	}, nil
+}
+
+func (c *Config) ToPreviewURLs() (*business.PreviewURLs, error) {
+	return business.NewPreviewURLs(c.PreviewURLPattern)
+}
+
+// ToDeployments returns nil when previews are only reported in comments.
+// Deployments are only created on installations whose permissions allow
+// it.
+func (c *Config) ToDeployments(permissions business.InstallationPermissions) *business.Deployments {
+	if !c.DeploymentsEnabled {
+		return nil
+	}
+	return &business.Deployments{Permissions: permissions}
+}
+
+// ToProvisioner returns nil when previews are only announced, not built.
+func (c *Config) ToProvisioner() (business.Provisioner, error) {
+	switch c.Provisioner {
+	case NoProvisionerBackend:
+		return nil, nil
+	case MemoryProvisionerBackend:
+		return business.NewMemoryProvisioner(), nil
+	case StaticProvisionerBackend:
+		sites, err := c.ToStaticSites()
+		if err != nil {
+			return nil, err
+		}
+		return sites, nil
+	}
+	return nil, fmt.Errorf("unknown provisioner %q", c.Provisioner)
+}
+
+func (c *Config) ToStaticSites() (*StaticSites, error) {
+	objects, err := c.toObjectStore(c.StaticSiteStoreDir, "sites/")
+	if err != nil {
+		return nil, err
+	}
+	sites := NewStaticSites(objects, c.StaticSiteDir, c.StaticSiteMaxBytes)
+	sites.Hosts = c.StaticSiteHosts
+	return sites, nil
+}
+
+// validateStaticSiteHosts checks STATIC_SITE_HOSTS is a wildcard domain.
+func (c *Config) validateStaticSiteHosts() error {
+	if c.StaticSiteHosts == "" {
+		return nil
+	}
+	domain := strings.TrimPrefix(c.StaticSiteHosts, "*.")
+	if domain == c.StaticSiteHosts || domain == "" || strings.Contains(domain, "*") {
+		return fmt.Errorf("static site hosts %q must be a wildcard domain like *.previews.example.com", c.StaticSiteHosts)
+	}
+	return nil
+}
+
+// ToReporter returns nil when builds are only reported in comments.
+// Permissions are only looked up by the auto reporter.
+func (c *Config) ToReporter(permissions business.InstallationPermissions) (business.Reporter, error) {
+	switch c.Reporter {
+	case AutoReporter:
+		return &business.AutoReporter{
+			Permissions: permissions,
+			Checks:      &business.Checks{},
+			Statuses:    &business.Statuses{},
+		}, nil
+	case ChecksReporter:
+		return &business.Checks{}, nil
+	case StatusesReporter:
+		return &business.Statuses{}, nil
+	case NoReporter:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown reporter %q", c.Reporter)
+}
+
+// ToMergeHook returns nil when no merge hook is configured.
+func (c *Config) ToMergeHook() business.MergeHook {
+	if c.MergeHookURL == "" {
+		return nil
+	}
+	return &business.WebhookMergeHook{
+		URL:    c.MergeHookURL,
+		Secret: c.MergeHookSecret,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// validateDynamoDB checks a table is configured when a backend needs one.
+func (c *Config) validateDynamoDB() error {
+	needsTable := c.DedupeBackend == DynamoDBDedupeBackend ||
+		c.LockBackend == DynamoDBLockBackend ||
+		(c.SupersedeStale && c.HeadStoreBackend == DynamoDBHeadStoreBackend)
+	if needsTable && c.DynamoDBTable == "" {
+		return errors.New("DYNAMODB_TABLE is required by the dynamodb backends")
+	}
+	return nil
+}
+
+func (c *Config) validateRuntime() error {
+	switch c.QueueBackend {
+	case MemoryQueueBackend:
+	case SQSQueueBackend:
+		if c.SQSQueueURL == "" {
+			return fmt.Errorf("SQS_QUEUE_URL is required by the %s queue backend", SQSQueueBackend)
+		}
+	default:
+		return fmt.Errorf("unknown queue backend %q", c.QueueBackend)
+	}
+	switch c.Runtime {
+	case LambdaRuntime:
+		if c.AsyncMode && c.QueueBackend == MemoryQueueBackend {
+			// a lambda is frozen as soon as it responds, so in-process
+			// workers would never run.
+			return fmt.Errorf("async mode on the %s runtime requires the %s queue backend", LambdaRuntime, SQSQueueBackend)
+		}
+	case ServerRuntime:
+	default:
+		return fmt.Errorf("unknown runtime %q", c.Runtime)
+	}
+	return nil
+}
+
+// ToSQSQueue sends deliveries to SQSQueueURL with the default AWS
+// credentials.
+func (c *Config) ToSQSQueue() (*SQSQueue, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &SQSQueue{
+		Sender:   &SQSClientSender{Client: sqs.NewFromConfig(cfg)},
+		QueueURL: c.SQSQueueURL,
+	}, nil
+}
+
 func NewConfig(ctx context.Context) (*Config, error) {
 	var config Config
 	if err := envconfig.Process(ctx, &config); err != nil {
@@ -45,5 +490,30 @@ func NewConfig(ctx context.Context) (*Config, error) {
 		return &config, err
 	}
 	config.PrivateKey = string(b)
+	if _, err := config.ToPermissionChecker(); err != nil {
+		return &config, err
+	}
+	if err := config.validateRuntime(); err != nil {
+		return &config, err
+	}
+	if err := config.validateDynamoDB(); err != nil {
+		return &config, err
+	}
+	if _, err := config.ToTemplateLoader(); err != nil {
+		return &config, err
+	}
+	if _, err := config.ToPreviewURLs(); err != nil {
+		return &config, err
+	}
+	if err := config.validateStaticSiteHosts(); err != nil {
+		return &config, err
+	}
+	if _, err := config.ToProvisioner(); err != nil {
+		return &config, err
+	}
+	if _, err := config.ToReporter(nil); err != nil {
+		return &config, err
+	}
+
 	return &config, err
 }
@@ -6,7 +6,9 @@ import (
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestConfig_ToGithubAppConfig(t *testing.T) {
@@ -91,9 +93,230 @@ func TestNewConfig(t *testing.T) {
 				PrivateKeyBytes:  []byte("c2VjcmV0"),
 				GithubV3Endpoint: "http://example.com/api",
 				PrivateKey:       "secret",
+
+				CommandMinPermission: "write",
+
+				DedupeBackend: "memory",
+				DedupeLease:   15 * time.Minute,
+				DedupeTTL:     72 * time.Hour,
+				DedupeDir:     "/tmp/gh-app-pr-hello/deliveries",
+
+				Runtime:           "lambda",
+				ListenAddr:        ":8080",
+				QueueBackend:      "memory",
+				QueueSize:         100,
+				WorkerConcurrency: 4,
+				WorkerMaxAttempts: 5,
+				WorkerBackoff:     time.Second,
+				DeadLetterDir:     "/tmp/gh-app-pr-hello/dead-letters",
+
+				LockBackend: "memory",
+				LockLease:   2 * time.Minute,
+
+				SupersedeStale:   true,
+				HeadStoreBackend: "memory",
+				HeadStoreTTL:     720 * time.Hour,
+
+				FilterSkipBots:        true,
+				FilterSkipDrafts:      true,
+				FilterSkipTitleMarker: "[skip preview]",
+
+				RepoRegistryDir: "/tmp/gh-app-pr-hello/repos",
+				AppConfigPath:   ".github/preview.yml",
+
+				PreviewURLPattern:  "http://example.com/site",
+				Provisioner:        "none",
+				StaticSiteDir:      "public",
+				StaticSiteStoreDir: "/tmp/gh-app-pr-hello/sites",
+				StaticSiteMaxBytes: 100 << 20,
+				DeploymentsEnabled: true,
+				Reporter:           "auto",
+				PermissionsTTL:     10 * time.Minute,
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "command restrictions and allow lists",
+			args: args{
+				ctx: context.Background(),
+				env: map[string]string{
+					"GITHUB_INTEGRATION_ID":  "10",
+					"GITHUB_WEBHOOK_SECRET":  "webhook",
+					"GITHUB_PRIVATE_KEY":     "c2VjcmV0",
+					"GITHUB_V3_ENDPOINT":     "http://example.com/api",
+					"COMMAND_MIN_PERMISSION": "maintain",
+					"COMMAND_TEAMS":          "acme/web,acme/ops",
+					"ALLOW_INSTALLATIONS":    "1,2",
+					"DENY_REPOS":             "acme/legacy",
+					"FILTER_SKIP_FORKS":      "false",
+				},
+			},
+			want: &Config{
+				IntegrationID:    10,
+				WebhookSecret:    "webhook",
+				PrivateKeyBytes:  []byte("c2VjcmV0"),
+				GithubV3Endpoint: "http://example.com/api",
+				PrivateKey:       "secret",
+
+				CommandMinPermission: "maintain",
+				CommandTeams:         []string{"acme/web", "acme/ops"},
+				AllowInstallations:   []int64{1, 2},
+				DenyRepos:            []string{"acme/legacy"},
+
+				DedupeBackend: "memory",
+				DedupeLease:   15 * time.Minute,
+				DedupeTTL:     72 * time.Hour,
+				DedupeDir:     "/tmp/gh-app-pr-hello/deliveries",
+
+				Runtime:           "lambda",
+				ListenAddr:        ":8080",
+				QueueBackend:      "memory",
+				QueueSize:         100,
+				WorkerConcurrency: 4,
+				WorkerMaxAttempts: 5,
+				WorkerBackoff:     time.Second,
+				DeadLetterDir:     "/tmp/gh-app-pr-hello/dead-letters",
+
+				LockBackend: "memory",
+				LockLease:   2 * time.Minute,
+
+				SupersedeStale:   true,
+				HeadStoreBackend: "memory",
+				HeadStoreTTL:     720 * time.Hour,
+
+				FilterSkipBots:        true,
+				FilterSkipForks:       boolRef(false),
+				FilterSkipDrafts:      true,
+				FilterSkipTitleMarker: "[skip preview]",
+
+				RepoRegistryDir: "/tmp/gh-app-pr-hello/repos",
+				AppConfigPath:   ".github/preview.yml",
+
+				PreviewURLPattern:  "http://example.com/site",
+				Provisioner:        "none",
+				StaticSiteDir:      "public",
+				StaticSiteStoreDir: "/tmp/gh-app-pr-hello/sites",
+				StaticSiteMaxBytes: 100 << 20,
+				DeploymentsEnabled: true,
+				Reporter:           "auto",
+				PermissionsTTL:     10 * time.Minute,
 			},
 			wantErr: assert.NoError,
 		},
+		{
+			name: "async mode on lambda",
+			args: args{
+				ctx: context.Background(),
+				env: map[string]string{
+					"GITHUB_INTEGRATION_ID": "10",
+					"GITHUB_WEBHOOK_SECRET": "webhook",
+					"GITHUB_PRIVATE_KEY":    "c2VjcmV0",
+					"GITHUB_V3_ENDPOINT":    "http://example.com/api",
+					"ASYNC_MODE":            "true",
+				},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "async mode on lambda with sqs",
+			args: args{
+				ctx: context.Background(),
+				env: map[string]string{
+					"GITHUB_INTEGRATION_ID": "10",
+					"GITHUB_WEBHOOK_SECRET": "webhook",
+					"GITHUB_PRIVATE_KEY":    "c2VjcmV0",
+					"GITHUB_V3_ENDPOINT":    "http://example.com/api",
+					"ASYNC_MODE":            "true",
+					"QUEUE_BACKEND":         "sqs",
+					"SQS_QUEUE_URL":         "https://sqs.us-east-1.amazonaws.com/123456789012/deliveries",
+				},
+			},
+			wantErr: assert.NoError,
+		},
+		{
+			name: "sqs queue without a url",
+			args: args{
+				ctx: context.Background(),
+				env: map[string]string{
+					"GITHUB_INTEGRATION_ID": "10",
+					"GITHUB_WEBHOOK_SECRET": "webhook",
+					"GITHUB_PRIVATE_KEY":    "c2VjcmV0",
+					"GITHUB_V3_ENDPOINT":    "http://example.com/api",
+					"QUEUE_BACKEND":         "sqs",
+				},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "unknown runtime",
+			args: args{
+				ctx: context.Background(),
+				env: map[string]string{
+					"GITHUB_INTEGRATION_ID": "10",
+					"GITHUB_WEBHOOK_SECRET": "webhook",
+					"GITHUB_PRIVATE_KEY":    "c2VjcmV0",
+					"GITHUB_V3_ENDPOINT":    "http://example.com/api",
+					"RUNTIME":               "kubernetes",
+				},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "unknown command permission",
+			args: args{
+				ctx: context.Background(),
+				env: map[string]string{
+					"GITHUB_INTEGRATION_ID":  "10",
+					"GITHUB_WEBHOOK_SECRET":  "webhook",
+					"GITHUB_PRIVATE_KEY":     "c2VjcmV0",
+					"GITHUB_V3_ENDPOINT":     "http://example.com/api",
+					"COMMAND_MIN_PERMISSION": "owner",
+				},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "dynamodb backend without a table",
+			args: args{
+				ctx: context.Background(),
+				env: map[string]string{
+					"GITHUB_INTEGRATION_ID": "10",
+					"GITHUB_WEBHOOK_SECRET": "webhook",
+					"GITHUB_PRIVATE_KEY":    "c2VjcmV0",
+					"GITHUB_V3_ENDPOINT":    "http://example.com/api",
+					"DEDUPE_BACKEND":        "dynamodb",
+				},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "dynamodb lock backend without a table",
+			args: args{
+				ctx: context.Background(),
+				env: map[string]string{
+					"GITHUB_INTEGRATION_ID": "10",
+					"GITHUB_WEBHOOK_SECRET": "webhook",
+					"GITHUB_PRIVATE_KEY":    "c2VjcmV0",
+					"GITHUB_V3_ENDPOINT":    "http://example.com/api",
+					"LOCK_BACKEND":          "dynamodb",
+				},
+			},
+			wantErr: assert.Error,
+		},
+		{
+			name: "static site hosts without wildcard",
+			args: args{
+				ctx: context.Background(),
+				env: map[string]string{
+					"GITHUB_INTEGRATION_ID": "10",
+					"GITHUB_WEBHOOK_SECRET": "webhook",
+					"GITHUB_PRIVATE_KEY":    "c2VjcmV0",
+					"GITHUB_V3_ENDPOINT":    "http://example.com/api",
+					"STATIC_SITE_HOSTS":     "previews.example.com",
+				},
+			},
+			wantErr: assert.Error,
+		},
 		{
 			name: "key is not base64 encoded",
 			args: args{
@@ -140,3 +363,232 @@ func TestNewConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestConfig_ToDedupeStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		want    interface{}
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "memory",
+			config:  Config{DedupeBackend: MemoryDedupeBackend, DedupeTTL: time.Hour},
+			want:    &MemoryDedupeStore{},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "file",
+			config:  Config{DedupeBackend: FileDedupeBackend, DedupeTTL: time.Hour, DedupeDir: t.TempDir()},
+			want:    &FileDedupeStore{},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "dynamodb",
+			config:  Config{DedupeBackend: DynamoDBDedupeBackend, DedupeTTL: time.Hour, DynamoDBTable: "previews"},
+			want:    &DynamoDBDedupeStore{},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "dynamodb without a table",
+			config:  Config{DedupeBackend: DynamoDBDedupeBackend},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "unknown",
+			config:  Config{DedupeBackend: "redis"},
+			wantErr: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.ToDedupeStore()
+			if !tt.wantErr(t, err) || err != nil {
+				return
+			}
+			assert.IsType(t, tt.want, got)
+		})
+	}
+}
+
+func TestConfig_ToEventFilter(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        Config
+		wantSkipForks bool
+	}{
+		{name: "default", config: Config{Provisioner: "none"}},
+		{name: "static provisioner", config: Config{Provisioner: StaticProvisionerBackend}, wantSkipForks: true},
+		{name: "static provisioner allowing forks", config: Config{Provisioner: StaticProvisionerBackend, FilterSkipForks: boolRef(false)}},
+		{name: "explicit skip", config: Config{Provisioner: "none", FilterSkipForks: boolRef(true)}, wantSkipForks: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantSkipForks, tt.config.ToEventFilter().SkipForks)
+		})
+	}
+}
+
+func TestConfig_ToStaticSites(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   ObjectStore
+	}{
+		{name: "local", config: Config{StaticSiteStoreDir: t.TempDir()}, want: &LocalObjectStore{}},
+		{name: "s3", config: Config{StaticSiteStoreDir: t.TempDir(), S3Bucket: "previews"}, want: &S3ObjectStore{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.ToStaticSites()
+			if assert.NoError(t, err) {
+				assert.IsType(t, tt.want, got.Objects)
+			}
+		})
+	}
+}
+
+func boolRef(b bool) *bool {
+	return &b
+}
+
+func TestConfig_ToPRLocks(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		want     interface{}
+		wantWait time.Duration
+		wantErr  assert.ErrorAssertionFunc
+	}{
+		{
+			name:     "memory",
+			config:   Config{LockBackend: MemoryLockBackend},
+			want:     &MemoryLocker{},
+			wantWait: 5 * time.Second,
+			wantErr:  assert.NoError,
+		},
+		{
+			name:     "dynamodb in async mode",
+			config:   Config{LockBackend: DynamoDBLockBackend, DynamoDBTable: "previews", AsyncMode: true},
+			want:     &DynamoDBLocker{},
+			wantWait: 30 * time.Second,
+			wantErr:  assert.NoError,
+		},
+		{
+			name:     "explicit wait",
+			config:   Config{LockBackend: MemoryLockBackend, LockWait: time.Minute},
+			want:     &MemoryLocker{},
+			wantWait: time.Minute,
+			wantErr:  assert.NoError,
+		},
+		{
+			name:    "dynamodb without a table",
+			config:  Config{LockBackend: DynamoDBLockBackend},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "unknown",
+			config:  Config{LockBackend: "redis"},
+			wantErr: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.ToPRLocks()
+			if !tt.wantErr(t, err) || err != nil {
+				return
+			}
+			assert.IsType(t, tt.want, got.Locker)
+			assert.Equal(t, tt.wantWait, got.Wait)
+		})
+	}
+}
+
+func TestConfig_ToSuperseder(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		want    interface{}
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "disabled",
+			config:  Config{HeadStoreBackend: "redis"},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "memory",
+			config:  Config{SupersedeStale: true, HeadStoreBackend: MemoryHeadStoreBackend},
+			want:    &MemoryHeadStore{},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "dynamodb",
+			config:  Config{SupersedeStale: true, HeadStoreBackend: DynamoDBHeadStoreBackend, DynamoDBTable: "previews"},
+			want:    &DynamoDBHeadStore{},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "dynamodb without a table",
+			config:  Config{SupersedeStale: true, HeadStoreBackend: DynamoDBHeadStoreBackend},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "unknown",
+			config:  Config{SupersedeStale: true, HeadStoreBackend: "redis"},
+			wantErr: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.ToSuperseder()
+			if !tt.wantErr(t, err) || err != nil {
+				return
+			}
+			if tt.want == nil {
+				assert.Nil(t, got)
+				return
+			}
+			assert.IsType(t, tt.want, got.Heads)
+		})
+	}
+}
+
+func TestConfig_ToTemplateLoader(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "no overrides",
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "valid override",
+			files:   map[string]string{"deployed.md": "Preview of #{{.Number}}: {{.PreviewURL}}\n", "README": "ignored"},
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "unknown template",
+			files:   map[string]string{"deploy.md": "hi"},
+			wantErr: assert.Error,
+		},
+		{
+			name:    "broken template",
+			files:   map[string]string{"destroyed.md": "{{.Missing}}"},
+			wantErr: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+			}
+			c := &Config{AppConfigPath: ".github/preview.yml", CommentTemplatesDir: dir}
+			_, err := c.ToTemplateLoader()
+			tt.wantErr(t, err)
+		})
+	}
+}
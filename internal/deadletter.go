@@ -0,0 +1,233 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog/log"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a delivery that could not be processed.
+type DeadLetter struct {
+	EventType  string          `json:"eventType"`
+	DeliveryID string          `json:"deliveryId"`
+	Payload    json.RawMessage `json:"payload"`
+	// Errors is the error chain of the final attempt, outermost first.
+	Errors   []string  `json:"errors"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// NewDeadLetter records the final failure of a delivery.
+func NewDeadLetter(d Delivery, attempts int, err error) DeadLetter {
+	return DeadLetter{
+		EventType:  d.EventType,
+		DeliveryID: d.DeliveryID,
+		Payload:    d.Payload,
+		Errors:     errorChain(err),
+		Attempts:   attempts,
+		FailedAt:   time.Now().UTC(),
+	}
+}
+
+// Delivery returns the original delivery so it can be processed again.
+func (l DeadLetter) Delivery() Delivery {
+	return Delivery{
+		EventType:  l.EventType,
+		DeliveryID: l.DeliveryID,
+		Payload:    l.Payload,
+	}
+}
+
+func errorChain(err error) []string {
+	var chain []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		chain = append(chain, err.Error())
+	}
+	return chain
+}
+
+// ErrDeadLetterNotFound is returned when no dead letter has the given
+// delivery ID.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetterStore keeps deliveries that exhausted their retries, keyed by
+// delivery ID. Storing a delivery again replaces the earlier failure.
+type DeadLetterStore interface {
+	Put(ctx context.Context, l DeadLetter) error
+	Get(ctx context.Context, deliveryID string) (DeadLetter, error)
+	// List returns all dead letters, oldest failure first.
+	List(ctx context.Context) ([]DeadLetter, error)
+	Delete(ctx context.Context, deliveryID string) error
+}
+
+// MemoryDeadLetterStore keeps dead letters in process memory.
+type MemoryDeadLetterStore struct {
+	mu      sync.Mutex
+	letters []DeadLetter
+}
+
+func (s *MemoryDeadLetterStore) Put(ctx context.Context, l DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(l.DeliveryID)
+	s.letters = append(s.letters, l)
+	return nil
+}
+
+func (s *MemoryDeadLetterStore) Get(ctx context.Context, deliveryID string) (DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, l := range s.letters {
+		if l.DeliveryID == deliveryID {
+			return l, nil
+		}
+	}
+	return DeadLetter{}, fmt.Errorf("%s: %w", deliveryID, ErrDeadLetterNotFound)
+}
+
+func (s *MemoryDeadLetterStore) List(ctx context.Context) ([]DeadLetter, error) {
+	letters := s.Letters()
+	sortDeadLetters(letters)
+	return letters, nil
+}
+
+func (s *MemoryDeadLetterStore) Delete(ctx context.Context, deliveryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remove(deliveryID)
+	return nil
+}
+
+// remove drops the letter for deliveryID. Callers must hold mu.
+func (s *MemoryDeadLetterStore) remove(deliveryID string) {
+	for i, l := range s.letters {
+		if l.DeliveryID == deliveryID {
+			s.letters = append(s.letters[:i], s.letters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Letters returns a copy of the stored dead letters.
+func (s *MemoryDeadLetterStore) Letters() []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DeadLetter(nil), s.letters...)
+}
+
+// ObjectDeadLetterStore keeps each dead letter as a JSON object in an
+// ObjectStore, such as a local directory or an S3 bucket.
+type ObjectDeadLetterStore struct {
+	Objects ObjectStore
+	Prefix  string
+}
+
+func (s *ObjectDeadLetterStore) key(deliveryID string) string {
+	return s.Prefix + url.PathEscape(deliveryID) + ".json"
+}
+
+func (s *ObjectDeadLetterStore) Put(ctx context.Context, l DeadLetter) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return s.Objects.PutObject(ctx, s.key(l.DeliveryID), b)
+}
+
+func (s *ObjectDeadLetterStore) Get(ctx context.Context, deliveryID string) (DeadLetter, error) {
+	return s.get(ctx, s.key(deliveryID), deliveryID)
+}
+
+func (s *ObjectDeadLetterStore) get(ctx context.Context, key, deliveryID string) (DeadLetter, error) {
+	b, err := s.Objects.GetObject(ctx, key)
+	if errors.Is(err, ErrObjectNotFound) {
+		return DeadLetter{}, fmt.Errorf("%s: %w", deliveryID, ErrDeadLetterNotFound)
+	} else if err != nil {
+		return DeadLetter{}, err
+	}
+	var l DeadLetter
+	if err := json.Unmarshal(b, &l); err != nil {
+		return DeadLetter{}, fmt.Errorf("decoding dead letter %s: %w", key, err)
+	}
+	return l, nil
+}
+
+func (s *ObjectDeadLetterStore) List(ctx context.Context) ([]DeadLetter, error) {
+	keys, err := s.Objects.ListObjects(ctx, s.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	letters := make([]DeadLetter, 0, len(keys))
+	for _, key := range keys {
+		l, err := s.get(ctx, key, key)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, l)
+	}
+	sortDeadLetters(letters)
+	return letters, nil
+}
+
+func sortDeadLetters(letters []DeadLetter) {
+	sort.SliceStable(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+}
+
+func (s *ObjectDeadLetterStore) Delete(ctx context.Context, deliveryID string) error {
+	return s.Objects.DeleteObject(ctx, s.key(deliveryID))
+}
+
+// Redrive runs a dead letter through handler again and removes it from the
+// store once it succeeds.
+func Redrive(ctx context.Context, store DeadLetterStore, handler githubapp.EventHandler, deliveryID string) error {
+	l, err := store.Get(ctx, deliveryID)
+	if err != nil {
+		return err
+	}
+	d := l.Delivery()
+	logger := log.With().
+		Str("event", d.EventType).
+		Str("delivery", d.DeliveryID).
+		Logger()
+	logger.Info().Msg("redriving dead letter")
+	if err := handler.Handle(logger.WithContext(ctx), d.EventType, d.DeliveryID, d.Payload); err != nil {
+		if business.Classify(err) != business.IgnoredError {
+			return err
+		}
+	}
+	return store.Delete(ctx, deliveryID)
+}
+
+// DeadLetterHandler stores the deliveries Handler fails on. It is used when
+// webhooks are processed synchronously, as GitHub does not redeliver failed
+// deliveries on its own.
+type DeadLetterHandler struct {
+	Handler     githubapp.EventHandler
+	DeadLetters DeadLetterStore
+}
+
+func (h *DeadLetterHandler) Handles() []string {
+	return h.Handler.Handles()
+}
+
+func (h *DeadLetterHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	err := h.Handler.Handle(ctx, eventType, deliveryID, payload)
+	if err == nil || business.Classify(err) == business.IgnoredError {
+		return err
+	}
+	d := Delivery{EventType: eventType, DeliveryID: deliveryID, Payload: payload}
+	if putErr := h.DeadLetters.Put(ctx, NewDeadLetter(d, 1, err)); putErr != nil {
+		log.Ctx(ctx).Err(putErr).Str("delivery", deliveryID).Msg("failed to store dead letter")
+	}
+	return err
+}
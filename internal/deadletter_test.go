@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func deadLetterStores(t *testing.T) map[string]DeadLetterStore {
+	objects, err := NewLocalObjectStore(t.TempDir())
+	assert.NoError(t, err)
+	return map[string]DeadLetterStore{
+		"memory": &MemoryDeadLetterStore{},
+		"object": &ObjectDeadLetterStore{Objects: objects, Prefix: "dead-letters/"},
+	}
+}
+
+func TestDeadLetterStores(t *testing.T) {
+	ctx := context.Background()
+	older := DeadLetter{
+		EventType:  "pull_request",
+		DeliveryID: "b/1",
+		Payload:    json.RawMessage(`{"action":"opened"}`),
+		Errors:     []string{"boom"},
+		Attempts:   5,
+		FailedAt:   time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	newer := older
+	newer.DeliveryID = "a"
+	newer.FailedAt = older.FailedAt.Add(time.Hour)
+
+	for name, store := range deadLetterStores(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, store.Put(ctx, newer))
+			assert.NoError(t, store.Put(ctx, older))
+
+			got, err := store.Get(ctx, "b/1")
+			assert.NoError(t, err)
+			assert.Equal(t, older, got)
+
+			letters, err := store.List(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, []DeadLetter{older, newer}, letters)
+
+			// storing the same delivery again replaces it.
+			assert.NoError(t, store.Put(ctx, older))
+			letters, err = store.List(ctx)
+			assert.NoError(t, err)
+			assert.Len(t, letters, 2)
+
+			assert.NoError(t, store.Delete(ctx, "b/1"))
+			_, err = store.Get(ctx, "b/1")
+			assert.True(t, errors.Is(err, ErrDeadLetterNotFound))
+		})
+	}
+}
+
+func TestRedrive(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		deliveryID string
+		wantErr    assert.ErrorAssertionFunc
+		wantKept   bool
+	}{
+		{name: "success removes the letter", deliveryID: "ok", wantErr: assert.NoError},
+		{name: "failure keeps the letter", deliveryID: "bad", wantErr: assert.Error, wantKept: true},
+		{name: "ignored removes the letter", deliveryID: "skipped", wantErr: assert.NoError},
+		{name: "unknown delivery", deliveryID: "missing", wantErr: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &MemoryDeadLetterStore{}
+			for _, id := range []string{"ok", "bad", "skipped"} {
+				assert.NoError(t, store.Put(ctx, DeadLetter{EventType: "pull_request", DeliveryID: id}))
+			}
+			handler := &deliveryHandler{fail: map[string]bool{"bad": true}}
+			tt.wantErr(t, Redrive(ctx, store, handler, tt.deliveryID))
+			_, err := store.Get(ctx, tt.deliveryID)
+			assert.Equal(t, tt.wantKept, err == nil)
+		})
+	}
+}
+
+func TestDeadLetterHandler(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		deliveryID string
+		wantErr    assert.ErrorAssertionFunc
+		wantStored bool
+	}{
+		{name: "success", deliveryID: "ok", wantErr: assert.NoError},
+		{name: "ignored", deliveryID: "skipped", wantErr: assert.Error},
+		{name: "permanent", deliveryID: "gone", wantErr: assert.Error, wantStored: true},
+		{name: "retryable", deliveryID: "bad", wantErr: assert.Error, wantStored: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &MemoryDeadLetterStore{}
+			handler := &DeadLetterHandler{
+				Handler:     &deliveryHandler{fail: map[string]bool{"bad": true}},
+				DeadLetters: store,
+			}
+			tt.wantErr(t, handler.Handle(ctx, "pull_request", tt.deliveryID, []byte(`{"action":"opened"}`)))
+			l, err := store.Get(ctx, tt.deliveryID)
+			assert.Equal(t, tt.wantStored, err == nil)
+			if tt.wantStored {
+				assert.Equal(t, Delivery{EventType: "pull_request", DeliveryID: tt.deliveryID, Payload: []byte(`{"action":"opened"}`)}, l.Delivery())
+				assert.Equal(t, 1, l.Attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	MemoryDedupeBackend   = "memory"
+	FileDedupeBackend     = "file"
+	DynamoDBDedupeBackend = "dynamodb"
+)
+
+// DedupeStore remembers webhook deliveries by their X-GitHub-Delivery ID so
+// redeliveries and retries are only processed once.
+//
+// A claim is a short lease held while the delivery is processed, so a
+// delivery whose process was killed mid-handler is picked up again once the
+// lease runs out. Only deliveries marked done are skipped for the full TTL.
+type DedupeStore interface {
+	// Claim leases the delivery and reports whether it was free. A false
+	// result means it was processed, or is being processed elsewhere.
+	Claim(ctx context.Context, deliveryID string) (bool, error)
+	// Done marks a claimed delivery as processed.
+	Done(ctx context.Context, deliveryID string) error
+	// Release forgets a claimed delivery so that a failed attempt can be
+	// retried.
+	Release(ctx context.Context, deliveryID string) error
+}
+
+// MemoryDedupeStore keeps claims in process memory.
+type MemoryDedupeStore struct {
+	lease   time.Duration
+	ttl     time.Duration
+	mu      sync.Mutex
+	expires map[string]time.Time
+	now     func() time.Time
+}
+
+func NewMemoryDedupeStore(lease, ttl time.Duration) *MemoryDedupeStore {
+	return &MemoryDedupeStore{
+		lease:   lease,
+		ttl:     ttl,
+		expires: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryDedupeStore) Claim(ctx context.Context, deliveryID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if exp, ok := s.expires[deliveryID]; ok && now.Before(exp) {
+		return false, nil
+	}
+	// drop expired claims while we hold the lock.
+	for id, exp := range s.expires {
+		if !now.Before(exp) {
+			delete(s.expires, id)
+		}
+	}
+	s.expires[deliveryID] = now.Add(s.lease)
+	return true, nil
+}
+
+func (s *MemoryDedupeStore) Done(ctx context.Context, deliveryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expires[deliveryID] = s.now().Add(s.ttl)
+	return nil
+}
+
+func (s *MemoryDedupeStore) Release(ctx context.Context, deliveryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.expires, deliveryID)
+	return nil
+}
+
+// FileDedupeStore keeps one marker file per claimed delivery in a local
+// directory, whose modification time is set to when the claim expires.
+type FileDedupeStore struct {
+	dir   string
+	lease time.Duration
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+func NewFileDedupeStore(dir string, lease, ttl time.Duration) (*FileDedupeStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileDedupeStore{dir: dir, lease: lease, ttl: ttl, now: time.Now}, nil
+}
+
+func (s *FileDedupeStore) path(deliveryID string) string {
+	// delivery IDs come from request headers, so never use them as paths.
+	sum := sha256.Sum256([]byte(deliveryID))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func (s *FileDedupeStore) Claim(ctx context.Context, deliveryID string) (bool, error) {
+	p := s.path(deliveryID)
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			if err := f.Close(); err != nil {
+				return false, err
+			}
+			return true, s.expire(p, s.lease)
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false, err
+		}
+		info, err := os.Stat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		if s.now().Before(info.ModTime()) {
+			return false, nil
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+	}
+	return false, fmt.Errorf("could not claim delivery %s", deliveryID)
+}
+
+func (s *FileDedupeStore) Done(ctx context.Context, deliveryID string) error {
+	return s.expire(s.path(deliveryID), s.ttl)
+}
+
+// expire sets the marker to expire after d.
+func (s *FileDedupeStore) expire(p string, d time.Duration) error {
+	exp := s.now().Add(d)
+	return os.Chtimes(p, exp, exp)
+}
+
+func (s *FileDedupeStore) Release(ctx context.Context, deliveryID string) error {
+	err := os.Remove(s.path(deliveryID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Values of DynamoDBDedupeStore items.
+const (
+	deliveryProcessing = "processing"
+	deliveryDone       = "done"
+)
+
+// DynamoDBDedupeStore keeps claims in a DynamoDB-style table, relying on a
+// conditional write so that concurrent Lambda invocations agree on a single
+// winner.
+type DynamoDBDedupeStore struct {
+	table DynamoTable
+	lease time.Duration
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+func NewDynamoDBDedupeStore(table DynamoTable, lease, ttl time.Duration) *DynamoDBDedupeStore {
+	return &DynamoDBDedupeStore{table: table, lease: lease, ttl: ttl, now: time.Now}
+}
+
+func (s *DynamoDBDedupeStore) key(deliveryID string) string {
+	return "delivery#" + deliveryID
+}
+
+func (s *DynamoDBDedupeStore) Claim(ctx context.Context, deliveryID string) (bool, error) {
+	return s.table.PutItemIfAbsent(ctx, DynamoItem{
+		Key:       s.key(deliveryID),
+		Value:     deliveryProcessing,
+		ExpiresAt: s.now().Add(s.lease),
+	})
+}
+
+func (s *DynamoDBDedupeStore) Done(ctx context.Context, deliveryID string) error {
+	item := DynamoItem{
+		Key:       s.key(deliveryID),
+		Value:     deliveryDone,
+		ExpiresAt: s.now().Add(s.ttl),
+	}
+	written, err := s.table.PutItemIfValue(ctx, item, deliveryProcessing)
+	if err != nil || written {
+		return err
+	}
+	// the lease ran out before the handler finished.
+	_, err = s.table.PutItemIfAbsent(ctx, item)
+	return err
+}
+
+func (s *DynamoDBDedupeStore) Release(ctx context.Context, deliveryID string) error {
+	return s.table.DeleteItem(ctx, s.key(deliveryID))
+}
+
+// DedupeHandler wraps an event handler so each delivery is processed at
+// most once. Deliveries that fail are released so GitHub can redeliver them;
+// ignored deliveries count as processed.
+type DedupeHandler struct {
+	Store   DedupeStore
+	Handler githubapp.EventHandler
+}
+
+func (h *DedupeHandler) Handles() []string {
+	return h.Handler.Handles()
+}
+
+func (h *DedupeHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	if deliveryID == "" {
+		return h.Handler.Handle(ctx, eventType, deliveryID, payload)
+	}
+	claimed, err := h.Store.Claim(ctx, deliveryID)
+	if err != nil {
+		zerolog.Ctx(ctx).Err(err).Str("delivery", deliveryID).Msg("failed to claim delivery")
+		return err
+	}
+	if !claimed {
+		zerolog.Ctx(ctx).Info().Str("delivery", deliveryID).Msg("skipping delivery that was already processed")
+		return nil
+	}
+	err = h.Handler.Handle(ctx, eventType, deliveryID, payload)
+	if err != nil && business.Classify(err) != business.IgnoredError {
+		if releaseErr := h.Store.Release(ctx, deliveryID); releaseErr != nil {
+			zerolog.Ctx(ctx).Err(releaseErr).Str("delivery", deliveryID).Msg("failed to release delivery")
+		}
+		return err
+	}
+	if doneErr := h.Store.Done(ctx, deliveryID); doneErr != nil {
+		// the claim runs out on its own, at worst the delivery is handled
+		// again.
+		zerolog.Ctx(ctx).Err(doneErr).Str("delivery", deliveryID).Msg("failed to mark delivery done")
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+type countingHandler struct {
+	calls int
+	err   error
+}
+
+func (h *countingHandler) Handles() []string {
+	return []string{"pull_request"}
+}
+
+func (h *countingHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h.calls++
+	return h.err
+}
+
+func dedupeStores(t *testing.T, clock *fakeClock) map[string]DedupeStore {
+	mem := NewMemoryDedupeStore(time.Minute, time.Hour)
+	mem.now = clock.now
+	file, err := NewFileDedupeStore(t.TempDir(), time.Minute, time.Hour)
+	assert.NoError(t, err)
+	file.now = clock.now
+	table := NewMemoryDynamoTable()
+	table.now = clock.now
+	dynamo := NewDynamoDBDedupeStore(table, time.Minute, time.Hour)
+	dynamo.now = clock.now
+	return map[string]DedupeStore{
+		"memory":   mem,
+		"file":     file,
+		"dynamodb": dynamo,
+	}
+}
+
+func TestDedupeStores(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Now()}
+	for name, store := range dedupeStores(t, clock) {
+		t.Run(name, func(t *testing.T) {
+			claimed, err := store.Claim(ctx, "delivery-1")
+			assert.NoError(t, err)
+			assert.True(t, claimed, "first claim")
+
+			claimed, err = store.Claim(ctx, "delivery-1")
+			assert.NoError(t, err)
+			assert.False(t, claimed, "duplicate claim")
+
+			assert.NoError(t, store.Release(ctx, "delivery-1"))
+			claimed, err = store.Claim(ctx, "delivery-1")
+			assert.NoError(t, err)
+			assert.True(t, claimed, "claim after release")
+
+			assert.NoError(t, store.Release(ctx, "never-claimed"))
+		})
+	}
+}
+
+func TestDedupeStores_expiry(t *testing.T) {
+	ctx := context.Background()
+	for name, store := range dedupeStores(t, &fakeClock{}) {
+		t.Run(name, func(t *testing.T) {
+			clock := &fakeClock{t: time.Now()}
+			setClock(store, clock)
+
+			claimed, err := store.Claim(ctx, "abandoned")
+			assert.NoError(t, err)
+			assert.True(t, claimed)
+			claimed, err = store.Claim(ctx, "processed")
+			assert.NoError(t, err)
+			assert.True(t, claimed)
+			assert.NoError(t, store.Done(ctx, "processed"))
+
+			// the lease of a delivery whose process died runs out.
+			clock.t = clock.t.Add(2 * time.Minute)
+			claimed, err = store.Claim(ctx, "abandoned")
+			assert.NoError(t, err)
+			assert.True(t, claimed, "abandoned claim")
+			claimed, err = store.Claim(ctx, "processed")
+			assert.NoError(t, err)
+			assert.False(t, claimed, "processed within ttl")
+
+			clock.t = clock.t.Add(2 * time.Hour)
+			claimed, err = store.Claim(ctx, "processed")
+			assert.NoError(t, err)
+			assert.True(t, claimed, "processed after ttl")
+		})
+	}
+}
+
+// setClock points a store from dedupeStores at clock.
+func setClock(store DedupeStore, clock *fakeClock) {
+	switch s := store.(type) {
+	case *MemoryDedupeStore:
+		s.now = clock.now
+	case *FileDedupeStore:
+		s.now = clock.now
+	case *DynamoDBDedupeStore:
+		s.now = clock.now
+		s.table.(*MemoryDynamoTable).now = clock.now
+	}
+}
+
+func TestFileDedupeStore_pathIsHashed(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileDedupeStore(dir, time.Minute, time.Hour)
+	assert.NoError(t, err)
+	claimed, err := store.Claim(context.Background(), "../../escape")
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Len(t, entries[0].Name(), 64)
+}
+
+func TestDedupeHandler_Handle(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		deliveries []string
+		handlerErr error
+		wantCalls  int
+		wantErr    assert.ErrorAssertionFunc
+	}{
+		{
+			name:       "redelivery is skipped",
+			deliveries: []string{"a", "a", "b"},
+			wantCalls:  2,
+			wantErr:    assert.NoError,
+		},
+		{
+			name:       "failed delivery is retried",
+			deliveries: []string{"a", "a"},
+			handlerErr: errors.New("github fail whale"),
+			wantCalls:  2,
+			wantErr:    assert.Error,
+		},
+		{
+			name:       "ignored delivery stays claimed",
+			deliveries: []string{"a", "a"},
+			handlerErr: business.Ignored(errors.New("draft")),
+			wantCalls:  1,
+			wantErr:    assert.NoError,
+		},
+		{
+			name:       "missing delivery id is always handled",
+			deliveries: []string{"", ""},
+			wantCalls:  2,
+			wantErr:    assert.NoError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := &countingHandler{err: tt.handlerErr}
+			h := &DedupeHandler{Store: NewMemoryDedupeStore(time.Minute, time.Hour), Handler: inner}
+			assert.Equal(t, inner.Handles(), h.Handles())
+			var err error
+			for _, id := range tt.deliveries {
+				err = h.Handle(ctx, "pull_request", id, []byte(`{}`))
+			}
+			tt.wantErr(t, err)
+			assert.Equal(t, tt.wantCalls, inner.calls)
+		})
+	}
+}
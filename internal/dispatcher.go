@@ -1,6 +1,8 @@
 package internal
 
 import (
+	"context"
+	"github.com/ehenry2/gh-app-pr-hello/business"
 	"github.com/palantir/go-githubapp/githubapp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -8,18 +10,176 @@ import (
 	"time"
 )
 
-func RegisterGithubWebhookDispatcher(config *githubapp.Config) error {
-	log.Info().Msg("registering route: github webhook dispatcher")
+// NewEventHandlers builds the event handlers shared by the webhook route and
+// the background workers.
+func NewEventHandlers(config *Config) ([]githubapp.EventHandler, error) {
+	githubAppConfig := config.ToGithubAppConfig()
+	permissions, err := config.ToPermissionChecker()
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := config.ToDedupeStore()
+	if err != nil {
+		return nil, err
+	}
+	templates, err := config.ToTemplateLoader()
+	if err != nil {
+		return nil, err
+	}
+	urls, err := config.ToPreviewURLs()
+	if err != nil {
+		return nil, err
+	}
+	provisioner, err := config.ToProvisioner()
+	if err != nil {
+		return nil, err
+	}
 	cc, err := githubapp.NewDefaultCachingClientCreator(
-		*config,
+		*githubAppConfig,
 		githubapp.WithClientMiddleware(
 			githubapp.ClientLogging(zerolog.InfoLevel)),
 		githubapp.WithClientTimeout(3*time.Second))
+	if err != nil {
+		return nil, err
+	}
+	perms := NewInstallationPermissionCache(cc, config.PermissionsTTL)
+	deployments := config.ToDeployments(perms)
+	reporter, err := config.ToReporter(perms)
+	if err != nil {
+		return nil, err
+	}
+	locks, err := config.ToPRLocks()
+	if err != nil {
+		return nil, err
+	}
+	supersede, err := config.ToSuperseder()
+	if err != nil {
+		return nil, err
+	}
+	deps := business.PreviewDeps{
+		Templates:   templates,
+		URLs:        urls,
+		Provisioner: provisioner,
+		Deployments: deployments,
+		Reporter:    reporter,
+	}
+	prHandler := PRHandler{
+		ClientCreator:           cc,
+		OpenHandler:             &business.PROpenHandler{PreviewDeps: deps},
+		CloseHandler:            &business.PRCloseHandler{PreviewDeps: deps, MergeHook: config.ToMergeHook()},
+		ReopenHandler:           &business.PRReopenHandler{PreviewDeps: deps},
+		SynchronizeHandler:      &business.PRSynchronizeHandler{PreviewDeps: deps},
+		ReadyForReviewHandler:   &business.PRReadyForReviewHandler{PreviewDeps: deps},
+		ConvertedToDraftHandler: &business.PRConvertedToDraftHandler{PreviewDeps: deps},
+		LabeledHandler:          &business.PRLabeledHandler{PreviewDeps: deps},
+		UnlabeledHandler:        &business.PRUnlabeledHandler{PreviewDeps: deps},
+		EditedHandler:           &business.PREditedHandler{PreviewDeps: deps},
+		Filter:                  config.ToEventFilter(),
+		Policy:                  config.ToInstallationPolicy(),
+		Locks:                   locks,
+		Supersede:               supersede,
+	}
+	commentHandler := IssueCommentHandler{
+		ClientCreator: cc,
+		CommandHandler: &business.CommandHandler{
+			SynchronizeHandler: prHandler.SynchronizeHandler,
+			CloseHandler:       prHandler.CloseHandler,
+			Permissions:        permissions,
+			URLs:               urls,
+			Provisioner:        provisioner,
+			Filter:             prHandler.Filter,
+		},
+		Policy: prHandler.Policy,
+		Locks:  prHandler.Locks,
+	}
+	checkRunHandler := CheckRunHandler{
+		ClientCreator: cc,
+		CheckRunHandler: &business.CheckRunHandler{
+			SynchronizeHandler: prHandler.SynchronizeHandler,
+			CloseHandler:       prHandler.CloseHandler,
+			Permissions:        permissions,
+			Filter:             prHandler.Filter,
+		},
+		Policy: prHandler.Policy,
+		Locks:  prHandler.Locks,
+	}
+	repos, err := config.ToRepoRegistry()
+	if err != nil {
+		return nil, err
+	}
+	installationHandler := InstallationHandler{
+		ClientCreator: cc,
+		Registry:      repos,
+		Onboarding:    config.ToOnboardingHandler(),
+		Teardown:      &PreviewTeardown{Provisioner: provisioner, Supersede: prHandler.Supersede},
+		Policy:        prHandler.Policy,
+		Permissions:   perms,
+	}
+	handlers := []githubapp.EventHandler{
+		&DedupeHandler{Store: deliveries, Handler: &prHandler},
+		&DedupeHandler{Store: deliveries, Handler: &commentHandler},
+		&DedupeHandler{Store: deliveries, Handler: &checkRunHandler},
+		&DedupeHandler{Store: deliveries, Handler: &installationHandler},
+	}
+	if config.LogPayloads {
+		for i, h := range handlers {
+			handlers[i] = &PayloadLoggingHandler{Handler: h, RedactPaths: config.RedactPaths()}
+		}
+	}
+	return handlers, nil
+}
+
+func RegisterGithubWebhookDispatcher(config *Config) error {
+	log.Info().Msg("registering route: github webhook dispatcher")
+	handlers, err := NewEventHandlers(config)
 	if err != nil {
 		return err
 	}
-	prHandler := PRHandler{ClientCreator: cc}
-	dispatcher := githubapp.NewDefaultEventDispatcher(*config, &prHandler)
+	opts := []githubapp.DispatcherOption{
+		githubapp.WithErrorCallback(ErrorCallback),
+	}
+	if config.AsyncMode {
+		log.Info().Str("queue", config.QueueBackend).Msg("processing webhooks asynchronously")
+		var queue Queue
+		switch config.QueueBackend {
+		case SQSQueueBackend:
+			// the worker lambda consumes the queue.
+			sqsQueue, err := config.ToSQSQueue()
+			if err != nil {
+				return err
+			}
+			queue = sqsQueue
+		default:
+			deadLetters, err := config.ToDeadLetterStore()
+			if err != nil {
+				return err
+			}
+			memoryQueue := NewMemoryQueue(config.QueueSize)
+			worker := &Worker{
+				Handler:     NewRouter(handlers...),
+				MaxAttempts: config.WorkerMaxAttempts,
+				Backoff:     config.WorkerBackoff,
+				DeadLetters: deadLetters,
+			}
+			go worker.Run(context.Background(), memoryQueue, config.WorkerConcurrency)
+			queue = memoryQueue
+		}
+		opts = append(opts,
+			githubapp.WithScheduler(&QueueScheduler{Queue: queue}),
+			githubapp.WithResponseCallback(AcceptedResponseCallback),
+		)
+	} else {
+		// failures are kept for `dlq redrive`, as the worker does in async
+		// mode.
+		deadLetters, err := config.ToDeadLetterStore()
+		if err != nil {
+			return err
+		}
+		for i, h := range handlers {
+			handlers[i] = &DeadLetterHandler{Handler: h, DeadLetters: deadLetters}
+		}
+	}
+	dispatcher := githubapp.NewEventDispatcher(handlers, config.WebhookSecret, opts...)
 	http.Handle("/default/api/github/hook", dispatcher)
 	return nil
 }
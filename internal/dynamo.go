@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DynamoItem is a single item in a DynamoDB-style table keyed by Key, with
+// ExpiresAt acting as the table's TTL attribute.
+type DynamoItem struct {
+	Key       string
+	Value     string
+	ExpiresAt time.Time
+}
+
+// DynamoTable is the subset of a DynamoDB table the app relies on: keyed
+// reads and conditional writes. DynamoDB deletes expired items lazily, so
+// implementations must treat items past ExpiresAt as absent.
+type DynamoTable interface {
+	GetItem(ctx context.Context, key string) (DynamoItem, bool, error)
+	// PutItemIfAbsent writes the item unless a live item already exists
+	// under its key, and reports whether the write happened.
+	PutItemIfAbsent(ctx context.Context, item DynamoItem) (bool, error)
+	// PutItemIfValue overwrites the live item under the item's key only when
+	// its Value equals expected, and reports whether the write happened.
+	PutItemIfValue(ctx context.Context, item DynamoItem, expected string) (bool, error)
+	DeleteItem(ctx context.Context, key string) error
+	// DeleteItemIfValue deletes the live item under key only when its Value
+	// equals expected, and reports whether the delete happened.
+	DeleteItemIfValue(ctx context.Context, key, expected string) (bool, error)
+}
+
+// MemoryDynamoTable is an in-process stand-in for a DynamoDB table, used for
+// local runs and tests.
+type MemoryDynamoTable struct {
+	mu    sync.Mutex
+	items map[string]DynamoItem
+	now   func() time.Time
+}
+
+func NewMemoryDynamoTable() *MemoryDynamoTable {
+	return &MemoryDynamoTable{
+		items: make(map[string]DynamoItem),
+		now:   time.Now,
+	}
+}
+
+// live returns the unexpired item under key. Callers must hold mu.
+func (t *MemoryDynamoTable) live(key string) (DynamoItem, bool) {
+	item, ok := t.items[key]
+	if !ok {
+		return DynamoItem{}, false
+	}
+	if !item.ExpiresAt.IsZero() && !t.now().Before(item.ExpiresAt) {
+		delete(t.items, key)
+		return DynamoItem{}, false
+	}
+	return item, true
+}
+
+func (t *MemoryDynamoTable) GetItem(ctx context.Context, key string) (DynamoItem, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	item, ok := t.live(key)
+	return item, ok, nil
+}
+
+func (t *MemoryDynamoTable) PutItemIfAbsent(ctx context.Context, item DynamoItem) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.live(item.Key); ok {
+		return false, nil
+	}
+	t.items[item.Key] = item
+	return true, nil
+}
+
+func (t *MemoryDynamoTable) PutItemIfValue(ctx context.Context, item DynamoItem, expected string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if current, ok := t.live(item.Key); !ok || current.Value != expected {
+		return false, nil
+	}
+	t.items[item.Key] = item
+	return true, nil
+}
+
+func (t *MemoryDynamoTable) DeleteItem(ctx context.Context, key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.items, key)
+	return nil
+}
+
+func (t *MemoryDynamoTable) DeleteItemIfValue(ctx context.Context, key, expected string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if current, ok := t.live(key); !ok || current.Value != expected {
+		return false, nil
+	}
+	delete(t.items, key)
+	return true, nil
+}
+
+// DynamoDBAPI is the subset of the DynamoDB client DynamoDBTable uses.
+type DynamoDBAPI interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// Attributes of DynamoDBTable items. The table's partition key is the string
+// attribute "pk", and "expires_at" should be enabled as its TTL attribute.
+const (
+	dynamoKeyAttr     = "pk"
+	dynamoValueAttr   = "item_value"
+	dynamoExpiresAttr = "expires_at"
+)
+
+// dynamoLive is true for items that exist and have not expired yet.
+const dynamoLive = "attribute_exists(pk) AND (attribute_not_exists(expires_at) OR expires_at > :now)"
+
+// DynamoDBTable is a DynamoTable backed by a DynamoDB table.
+type DynamoDBTable struct {
+	Client DynamoDBAPI
+	Name   string
+	now    func() time.Time
+}
+
+func NewDynamoDBTable(client DynamoDBAPI, name string) *DynamoDBTable {
+	return &DynamoDBTable{Client: client, Name: name, now: time.Now}
+}
+
+func (t *DynamoDBTable) key(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{dynamoKeyAttr: &types.AttributeValueMemberS{Value: key}}
+}
+
+func (t *DynamoDBTable) nowValue() types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.now().Unix(), 10)}
+}
+
+func (t *DynamoDBTable) GetItem(ctx context.Context, key string) (DynamoItem, bool, error) {
+	out, err := t.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(t.Name),
+		Key:            t.key(key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || out.Item == nil {
+		return DynamoItem{}, false, err
+	}
+	item := DynamoItem{Key: key}
+	if v, ok := out.Item[dynamoValueAttr].(*types.AttributeValueMemberS); ok {
+		item.Value = v.Value
+	}
+	if v, ok := out.Item[dynamoExpiresAttr].(*types.AttributeValueMemberN); ok {
+		secs, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			return DynamoItem{}, false, fmt.Errorf("%s: %w", key, err)
+		}
+		item.ExpiresAt = time.Unix(secs, 0)
+		// DynamoDB only deletes expired items eventually.
+		if !t.now().Before(item.ExpiresAt) {
+			return DynamoItem{}, false, nil
+		}
+	}
+	return item, true, nil
+}
+
+func (t *DynamoDBTable) PutItemIfAbsent(ctx context.Context, item DynamoItem) (bool, error) {
+	return t.put(ctx, item, "NOT ("+dynamoLive+")", nil)
+}
+
+func (t *DynamoDBTable) PutItemIfValue(ctx context.Context, item DynamoItem, expected string) (bool, error) {
+	return t.put(ctx, item, dynamoLive+" AND item_value = :expected", &expected)
+}
+
+func (t *DynamoDBTable) put(ctx context.Context, item DynamoItem, condition string, expected *string) (bool, error) {
+	attrs := t.key(item.Key)
+	attrs[dynamoValueAttr] = &types.AttributeValueMemberS{Value: item.Value}
+	if !item.ExpiresAt.IsZero() {
+		attrs[dynamoExpiresAttr] = &types.AttributeValueMemberN{Value: strconv.FormatInt(item.ExpiresAt.Unix(), 10)}
+	}
+	values := map[string]types.AttributeValue{":now": t.nowValue()}
+	if expected != nil {
+		values[":expected"] = &types.AttributeValueMemberS{Value: *expected}
+	}
+	_, err := t.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(t.Name),
+		Item:                      attrs,
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	})
+	return conditionMet(err)
+}
+
+func (t *DynamoDBTable) DeleteItem(ctx context.Context, key string) error {
+	_, err := t.Client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(t.Name),
+		Key:       t.key(key),
+	})
+	return err
+}
+
+func (t *DynamoDBTable) DeleteItemIfValue(ctx context.Context, key, expected string) (bool, error) {
+	_, err := t.Client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(t.Name),
+		Key:                 t.key(key),
+		ConditionExpression: aws.String(dynamoLive + " AND item_value = :expected"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now":      t.nowValue(),
+			":expected": &types.AttributeValueMemberS{Value: expected},
+		},
+	})
+	return conditionMet(err)
+}
+
+// conditionMet turns a failed write condition into false.
+func conditionMet(err error) (bool, error) {
+	var failed *types.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// fakeDynamoDB returns canned responses and records the last write.
+type fakeDynamoDB struct {
+	item     map[string]types.AttributeValue
+	err      error
+	lastPut  *dynamodb.PutItemInput
+	lastDrop *dynamodb.DeleteItemInput
+}
+
+func (f *fakeDynamoDB) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: f.item}, f.err
+}
+
+func (f *fakeDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.lastPut = params
+	return &dynamodb.PutItemOutput{}, f.err
+}
+
+func (f *fakeDynamoDB) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	f.lastDrop = params
+	return &dynamodb.DeleteItemOutput{}, f.err
+}
+
+func TestDynamoDBTable_GetItem(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		name   string
+		item   map[string]types.AttributeValue
+		want   DynamoItem
+		wantOK bool
+	}{
+		{name: "missing", wantOK: false},
+		{
+			name: "live",
+			item: map[string]types.AttributeValue{
+				"pk":         &types.AttributeValueMemberS{Value: "lock#a"},
+				"item_value": &types.AttributeValueMemberS{Value: "owner"},
+				"expires_at": &types.AttributeValueMemberN{Value: "1060"},
+			},
+			want:   DynamoItem{Key: "lock#a", Value: "owner", ExpiresAt: time.Unix(1060, 0)},
+			wantOK: true,
+		},
+		{
+			name: "expired but not deleted yet",
+			item: map[string]types.AttributeValue{
+				"pk":         &types.AttributeValueMemberS{Value: "lock#a"},
+				"item_value": &types.AttributeValueMemberS{Value: "owner"},
+				"expires_at": &types.AttributeValueMemberN{Value: "1000"},
+			},
+			wantOK: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewDynamoDBTable(&fakeDynamoDB{item: tt.item}, "previews")
+			table.now = func() time.Time { return now }
+			got, ok, err := table.GetItem(context.Background(), "lock#a")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDynamoDBTable_conditionalWrites(t *testing.T) {
+	ctx := context.Background()
+	failed := &types.ConditionalCheckFailedException{Message: aws.String("conditional request failed")}
+	item := DynamoItem{Key: "lock#a", Value: "owner", ExpiresAt: time.Unix(1060, 0)}
+
+	client := &fakeDynamoDB{}
+	table := NewDynamoDBTable(client, "previews")
+	table.now = func() time.Time { return time.Unix(1000, 0) }
+	written, err := table.PutItemIfAbsent(ctx, item)
+	assert.NoError(t, err)
+	assert.True(t, written)
+	assert.Equal(t, "previews", aws.ToString(client.lastPut.TableName))
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "1060"}, client.lastPut.Item["expires_at"])
+	assert.Equal(t, &types.AttributeValueMemberN{Value: "1000"}, client.lastPut.ExpressionAttributeValues[":now"])
+
+	client.err = failed
+	written, err = table.PutItemIfValue(ctx, item, "other")
+	assert.NoError(t, err)
+	assert.False(t, written)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "other"}, client.lastPut.ExpressionAttributeValues[":expected"])
+
+	deleted, err := table.DeleteItemIfValue(ctx, "lock#a", "owner")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	client.err = &types.ProvisionedThroughputExceededException{}
+	_, err = table.PutItemIfAbsent(ctx, item)
+	assert.Error(t, err)
+}
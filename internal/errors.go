@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"errors"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+	"net/http"
+)
+
+// ErrorCallback is the dispatcher error callback. It maps the error kinds
+// returned by the business handlers to status codes, so GitHub's delivery
+// log shows which failures are worth redelivering.
+func ErrorCallback(w http.ResponseWriter, r *http.Request, err error) {
+	var ve githubapp.ValidationError
+	if errors.As(err, &ve) || errors.Is(err, githubapp.ErrCapacityExceeded) {
+		githubapp.DefaultErrorCallback(w, r, err)
+		return
+	}
+
+	kind := business.Classify(err)
+	logger := zerolog.Ctx(r.Context())
+	switch kind {
+	case business.IgnoredError:
+		logger.Info().Err(err).Str("error_kind", kind.String()).Msg("webhook event ignored")
+		w.WriteHeader(http.StatusOK)
+	case business.PermanentError:
+		logger.Error().Err(err).Str("error_kind", kind.String()).Msg("webhook event failed permanently")
+		http.Error(w, http.StatusText(http.StatusUnprocessableEntity), http.StatusUnprocessableEntity)
+	default:
+		logger.Error().Err(err).Str("error_kind", kind.String()).Msg("webhook event failed, redelivery may succeed")
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	}
+}
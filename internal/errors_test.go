@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorCallback(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "invalid signature", err: githubapp.ValidationError{Cause: errors.New("bad signature")}, want: http.StatusBadRequest},
+		{name: "queue full", err: fmt.Errorf("queue: %w", githubapp.ErrCapacityExceeded), want: http.StatusServiceUnavailable},
+		{name: "ignored", err: business.Ignored(errors.New("draft")), want: http.StatusOK},
+		{name: "permanent", err: business.Permanent(errors.New("repository deleted")), want: http.StatusUnprocessableEntity},
+		{name: "retryable", err: errors.New("timeout"), want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ErrorCallback(w, httptest.NewRequest(http.MethodPost, "/", nil), tt.err)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
@@ -11,7 +11,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"unicode/utf8"
 )
 
 func decodeLambdaBody(body string, out *bytes.Buffer) error {
@@ -32,6 +34,21 @@ func getRequestBody(r *events.ALBTargetGroupRequest) (*bytes.Buffer, error) {
 	return reqBody, nil
 }
 
+// requestHost returns the Host header of r, which the load balancer passes
+// in lowercase, or localhost when it is missing or not a plain host.
+func requestHost(r *events.ALBTargetGroupRequest) string {
+	for k, v := range r.Headers {
+		if !strings.EqualFold(k, "Host") || v == "" {
+			continue
+		}
+		if u, err := url.Parse("//" + v); err == nil && u.Host == v && u.User == nil {
+			return v
+		}
+		break
+	}
+	return "localhost"
+}
+
 func eventToHttpRequest(r events.ALBTargetGroupRequest) (*http.Request, error) {
 	rawURL := fmt.Sprintf("https://localhost%s", r.Path)
 	body, err := getRequestBody(&r)
@@ -45,6 +62,8 @@ func eventToHttpRequest(r events.ALBTargetGroupRequest) (*http.Request, error) {
 	for k, v := range r.Headers {
 		req.Header.Set(k, v)
 	}
+	// the host only selects a preview, it never changes the routed path.
+	req.Host = requestHost(&r)
 	return req, nil
 }
 
@@ -65,10 +84,20 @@ func responseToEvent(resp *http.Response) (events.ALBTargetGroupResponse, error)
 		Body:              string(b),
 		IsBase64Encoded:   false,
 	}
+	if !utf8.Valid(b) {
+		// the load balancer only passes binary bodies, like images, through
+		// base64.
+		event.Body = base64.StdEncoding.EncodeToString(b)
+		event.IsBase64Encoded = true
+	}
 	return event, nil
 }
 
-type AlbHandler struct{}
+// AlbHandler serves load balancer requests through Handler, or through
+// http.DefaultServeMux when it is nil.
+type AlbHandler struct {
+	Handler http.Handler
+}
 
 func (h *AlbHandler) ProxyWithContext(ctx context.Context, r events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
 	ctx = log.Logger.WithContext(ctx)
@@ -78,6 +107,10 @@ func (h *AlbHandler) ProxyWithContext(ctx context.Context, r events.ALBTargetGro
 	}
 	req = req.WithContext(ctx)
 	recorder := httptest.NewRecorder()
-	http.DefaultServeMux.ServeHTTP(recorder, req)
+	handler := h.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	handler.ServeHTTP(recorder, req)
 	return responseToEvent(recorder.Result())
 }
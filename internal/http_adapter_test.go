@@ -189,6 +189,14 @@ func Test_eventToHttpRequest(t *testing.T) {
 	badRequest.IsBase64Encoded = true
 	badRequestUrl := validLambdaRequest()
 	badRequestUrl.Path = "!@#$%^&**(("
+	hostRequest := validLambdaRequest()
+	hostRequest.Headers["host"] = "pr-1--site.previews.example.com"
+	wantHostRequest := validHttpRequest(t)
+	wantHostRequest.Host = "pr-1--site.previews.example.com"
+	pathHostRequest := validLambdaRequest()
+	pathHostRequest.Headers["host"] = "x/previews/o/r/1/"
+	badHostRequest := validLambdaRequest()
+	badHostRequest.Headers["host"] = "bad host%"
 	type args struct {
 		r events.ALBTargetGroupRequest
 	}
@@ -204,6 +212,24 @@ func Test_eventToHttpRequest(t *testing.T) {
 			want:    validHttpRequest(t),
 			wantErr: assert.NoError,
 		},
+		{
+			name:    "host header",
+			args:    args{r: *hostRequest},
+			want:    wantHostRequest,
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "host header with a path",
+			args:    args{r: *pathHostRequest},
+			want:    validHttpRequest(t),
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "invalid host header",
+			args:    args{r: *badHostRequest},
+			want:    validHttpRequest(t),
+			wantErr: assert.NoError,
+		},
 		{
 			name:    "invalid b64 encoding",
 			args:    args{r: *badRequest},
@@ -225,6 +251,7 @@ func Test_eventToHttpRequest(t *testing.T) {
 				defer got.Body.Close()
 				assert.Equal(t, tt.want.Method, got.Method)
 				assert.Equal(t, tt.want.URL, got.URL)
+				assert.Equal(t, tt.want.Host, got.Host)
 				gotBody, err := ioutil.ReadAll(got.Body)
 				assert.NoError(t, err)
 				wantBody, err := ioutil.ReadAll(tt.want.Body)
@@ -244,6 +271,11 @@ func Test_responseToEvent(t *testing.T) {
 	respMultiHeader.Header = map[string][]string{
 		"X-Foo-Bar": []string{"foo", "bar"},
 	}
+	binaryResp := validHTTPResponse()
+	binaryResp.Header = map[string][]string{
+		"Content-Type": []string{"image/png"},
+	}
+	binaryResp.Body = ioutil.NopCloser(bytes.NewBufferString("\x89PNG\r\n\x1a\n"))
 	type args struct {
 		resp *http.Response
 	}
@@ -283,6 +315,21 @@ func Test_responseToEvent(t *testing.T) {
 			},
 			wantErr: assert.NoError,
 		},
+		{
+			name: "binary body",
+			args: args{resp: binaryResp},
+			want: events.ALBTargetGroupResponse{
+				StatusCode:        200,
+				StatusDescription: "200 OK",
+				Headers: map[string]string{
+					"Content-Type": "image/png",
+				},
+				MultiValueHeaders: nil,
+				Body:              "iVBORw0KGgo=",
+				IsBase64Encoded:   true,
+			},
+			wantErr: assert.NoError,
+		},
 		{
 			name:    "response reading error",
 			args:    args{resp: errHttpResp},
@@ -0,0 +1,252 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/google/go-github/v47/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+	"strings"
+	"time"
+)
+
+const (
+	CreatedAction = "created"
+	DeletedAction = "deleted"
+	AddedAction   = "added"
+	RemovedAction = "removed"
+
+	NewPermissionsAcceptedAction = "new_permissions_accepted"
+)
+
+// RepoTeardown removes the previews and state kept for a repository once the
+// app can no longer act on it.
+type RepoTeardown interface {
+	TeardownRepo(ctx context.Context, repo InstalledRepo) error
+}
+
+// PreviewTeardown destroys the previews of a repository and forgets the
+// heads recorded for their pull requests. Deployments and comments stay on
+// GitHub, where the app can no longer reach them.
+type PreviewTeardown struct {
+	// Provisioner only has previews to destroy when it implements
+	// business.RepoPreviews.
+	Provisioner business.Provisioner
+	// Supersede is nil when no heads are recorded.
+	Supersede *Superseder
+}
+
+func (t *PreviewTeardown) TeardownRepo(ctx context.Context, repo InstalledRepo) error {
+	previews, ok := t.Provisioner.(business.RepoPreviews)
+	if !ok {
+		return nil
+	}
+	numbers, err := previews.Previews(ctx, repo.Owner(), repo.Name())
+	if err != nil {
+		return err
+	}
+	for _, number := range numbers {
+		preview := business.Preview{Owner: repo.Owner(), Repo: repo.Name(), Number: number}
+		if err := t.Provisioner.Destroy(ctx, nil, preview); err != nil {
+			return err
+		}
+		if t.Supersede != nil {
+			if err := t.Supersede.Heads.Forget(ctx, PRLockKey(repo.FullName, number)); err != nil {
+				return err
+			}
+		}
+		zerolog.Ctx(ctx).Info().Str("repo", repo.FullName).Int("pr", number).Msg("destroyed preview")
+	}
+	return nil
+}
+
+// InstallationHandler tracks the repositories the app is installed on. Newly
+// added repositories are offered an onboarding pull request, and removed
+// repositories are torn down.
+type InstallationHandler struct {
+	ClientCreator githubapp.ClientCreator
+	Registry      RepoRegistry
+	// Onboarding opens the onboarding pull requests. None are opened when it
+	// is nil.
+	Onboarding *business.OnboardingHandler
+	// Teardown runs for every removed repository before it leaves the
+	// registry. Only registry entries are removed when it is nil.
+	Teardown RepoTeardown
+	Policy   *InstallationPolicy
+	// Permissions is told when an installation's permissions change.
+	Permissions *InstallationPermissionCache
+}
+
+func (h *InstallationHandler) Handles() []string {
+	return []string{"installation", "installation_repositories"}
+}
+
+func (h *InstallationHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var (
+		installation *github.Installation
+		action       string
+		added        []*github.Repository
+		removed      []*github.Repository
+		uninstalled  bool
+	)
+	switch eventType {
+	case "installation":
+		var event github.InstallationEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			zerolog.Ctx(ctx).Err(err).Str("delivery", deliveryID).Msg("failed to decode json")
+			return business.Permanent(err)
+		}
+		installation, action = event.GetInstallation(), event.GetAction()
+		switch action {
+		case CreatedAction:
+			added = event.Repositories
+		case DeletedAction:
+			uninstalled = true
+			removed = event.Repositories
+			h.Permissions.Forget(installation.GetID())
+		case NewPermissionsAcceptedAction:
+			h.Permissions.Forget(installation.GetID())
+		}
+	case "installation_repositories":
+		var event github.InstallationRepositoriesEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			zerolog.Ctx(ctx).Err(err).Str("delivery", deliveryID).Msg("failed to decode json")
+			return business.Permanent(err)
+		}
+		installation, action = event.GetInstallation(), event.GetAction()
+		switch action {
+		case AddedAction:
+			added = event.RepositoriesAdded
+		case RemovedAction:
+			removed = event.RepositoriesRemoved
+		}
+	}
+
+	logger := zerolog.Ctx(ctx).With().
+		Str("delivery", deliveryID).
+		Str("event", eventType).
+		Str("action", action).
+		Int64("installation", installation.GetID()).
+		Str("account", installation.GetAccount().GetLogin()).
+		Logger()
+	ctx = logger.WithContext(ctx)
+	if uninstalled {
+		return h.uninstall(ctx, installation, removed)
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		logger.Info().Msg("ignoring installation event without repository changes")
+		return nil
+	}
+	logger.Info().Int("added", len(added)).Int("removed", len(removed)).Msg("handling installation event")
+
+	var firstErr error
+	for _, r := range removed {
+		repo := h.installedRepo(installation, r)
+		if err := h.removeRepo(ctx, repo); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, r := range added {
+		repo := h.installedRepo(installation, r)
+		if err := h.addRepo(ctx, repo); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// installedRepo fills in the owner, which installation payloads leave out of
+// their repository entries.
+func (h *InstallationHandler) installedRepo(installation *github.Installation, r *github.Repository) InstalledRepo {
+	fullName := r.GetFullName()
+	if fullName == "" {
+		fullName = installation.GetAccount().GetLogin() + "/" + r.GetName()
+	}
+	return InstalledRepo{
+		InstallationID: installation.GetID(),
+		FullName:       fullName,
+		AddedAt:        time.Now().UTC(),
+	}
+}
+
+func (h *InstallationHandler) addRepo(ctx context.Context, repo InstalledRepo) error {
+	logger := zerolog.Ctx(ctx).With().Str("repo", repo.FullName).Logger()
+	ghRepo := &github.Repository{
+		Owner:    &github.User{Login: github.String(repo.Owner())},
+		Name:     github.String(repo.Name()),
+		FullName: github.String(repo.FullName),
+	}
+	if reason := h.Policy.Check(repo.InstallationID, ghRepo); reason != "" {
+		logger.Info().Str("skip_reason", reason).Msg("ignoring repository outside the installation policy")
+		return nil
+	}
+	if err := h.Registry.Add(ctx, repo); err != nil {
+		logger.Err(err).Msg("failed to record repository")
+		return err
+	}
+	if h.Onboarding == nil {
+		return nil
+	}
+
+	client, err := h.ClientCreator.NewInstallationClient(repo.InstallationID)
+	if err != nil {
+		logger.Err(err).Msg("failed to create installation client")
+		return err
+	}
+	pr, err := h.Onboarding.Handle(ctx, client, repo.Owner(), repo.Name())
+	if err != nil {
+		logger.Err(err).Msg("failed to open onboarding pull request")
+		return err
+	}
+	if pr != nil {
+		logger.Info().Int("pr", pr.GetNumber()).Msg("opened onboarding pull request")
+	}
+	return nil
+}
+
+func (h *InstallationHandler) removeRepo(ctx context.Context, repo InstalledRepo) error {
+	logger := zerolog.Ctx(ctx).With().Str("repo", repo.FullName).Logger()
+	if h.Teardown != nil {
+		if err := h.Teardown.TeardownRepo(ctx, repo); err != nil {
+			logger.Err(err).Msg("failed to tear down repository")
+			return err
+		}
+	}
+	if err := h.Registry.Remove(ctx, repo.InstallationID, repo.FullName); err != nil {
+		logger.Err(err).Msg("failed to forget repository")
+		return err
+	}
+	logger.Info().Msg("removed repository")
+	return nil
+}
+
+// uninstall tears down every repository recorded for the installation, and
+// the repositories the event lists, which the registry may have missed.
+func (h *InstallationHandler) uninstall(ctx context.Context, installation *github.Installation, listed []*github.Repository) error {
+	logger := zerolog.Ctx(ctx)
+	repos, err := h.Registry.List(ctx, installation.GetID())
+	if err != nil {
+		logger.Err(err).Msg("failed to list installed repositories")
+		return err
+	}
+	recorded := make(map[string]bool, len(repos))
+	for _, repo := range repos {
+		recorded[strings.ToLower(repo.FullName)] = true
+	}
+	for _, r := range listed {
+		repo := h.installedRepo(installation, r)
+		if !recorded[strings.ToLower(repo.FullName)] {
+			recorded[strings.ToLower(repo.FullName)] = true
+			repos = append(repos, repo)
+		}
+	}
+	logger.Info().Int("removed", len(repos)).Msg("handling uninstall")
+	var firstErr error
+	for _, repo := range repos {
+		if err := h.removeRepo(ctx, repo); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
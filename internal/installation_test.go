@@ -0,0 +1,166 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type recordingTeardown struct {
+	repos []string
+	err   error
+}
+
+func (t *recordingTeardown) TeardownRepo(ctx context.Context, repo InstalledRepo) error {
+	t.repos = append(t.repos, repo.FullName)
+	return t.err
+}
+
+func TestInstallationHandler_Handles(t *testing.T) {
+	h := &InstallationHandler{}
+	assert.Equal(t, []string{"installation", "installation_repositories"}, h.Handles())
+}
+
+func TestInstallationHandler_Handle(t *testing.T) {
+	tests := []struct {
+		name          string
+		eventType     string
+		payload       string
+		existing      []string
+		teardownErr   error
+		wantRepos     []string
+		wantTeardowns []string
+		wantErr       assert.ErrorAssertionFunc
+	}{
+		{
+			name:      "invalid json",
+			eventType: "installation",
+			payload:   `{"action":`,
+			wantErr:   assert.Error,
+		},
+		{
+			name:      "permissions changed",
+			eventType: "installation",
+			payload:   `{"action": "new_permissions_accepted", "installation": {"id": 1, "account": {"login": "acme"}}}`,
+			existing:  []string{"acme/web"},
+			wantRepos: []string{"acme/web"},
+			wantErr:   assert.NoError,
+		},
+		{
+			name:      "installed on repositories",
+			eventType: "installation",
+			payload:   `{"action": "created", "installation": {"id": 1, "account": {"login": "acme"}}, "repositories": [{"name": "web", "full_name": "acme/web"}, {"name": "api"}]}`,
+			wantRepos: []string{"acme/api", "acme/web"},
+			wantErr:   assert.NoError,
+		},
+		{
+			name:      "denied repository is not recorded",
+			eventType: "installation_repositories",
+			payload:   `{"action": "added", "installation": {"id": 1, "account": {"login": "acme"}}, "repositories_added": [{"name": "legacy", "full_name": "acme/legacy"}]}`,
+			wantErr:   assert.NoError,
+		},
+		{
+			name:          "repository removed",
+			eventType:     "installation_repositories",
+			payload:       `{"action": "removed", "installation": {"id": 1, "account": {"login": "acme"}}, "repositories_removed": [{"name": "web", "full_name": "acme/web"}]}`,
+			existing:      []string{"acme/api", "acme/web"},
+			wantRepos:     []string{"acme/api"},
+			wantTeardowns: []string{"acme/web"},
+			wantErr:       assert.NoError,
+		},
+		{
+			name:          "uninstalled",
+			eventType:     "installation",
+			payload:       `{"action": "deleted", "installation": {"id": 1, "account": {"login": "acme"}}}`,
+			existing:      []string{"acme/api", "acme/web"},
+			wantTeardowns: []string{"acme/api", "acme/web"},
+			wantErr:       assert.NoError,
+		},
+		{
+			name:          "uninstalled with unrecorded repositories",
+			eventType:     "installation",
+			payload:       `{"action": "deleted", "installation": {"id": 1, "account": {"login": "acme"}}, "repositories": [{"name": "web", "full_name": "Acme/Web"}, {"name": "docs"}]}`,
+			existing:      []string{"acme/web"},
+			wantTeardowns: []string{"acme/web", "acme/docs"},
+			wantErr:       assert.NoError,
+		},
+		{
+			name:          "teardown failure keeps the repository",
+			eventType:     "installation",
+			payload:       `{"action": "deleted", "installation": {"id": 1, "account": {"login": "acme"}}}`,
+			existing:      []string{"acme/web"},
+			teardownErr:   errors.New("boom"),
+			wantRepos:     []string{"acme/web"},
+			wantTeardowns: []string{"acme/web"},
+			wantErr:       assert.Error,
+		},
+		{
+			name:      "suspended",
+			eventType: "installation",
+			payload:   `{"action": "suspend", "installation": {"id": 1, "account": {"login": "acme"}}}`,
+			existing:  []string{"acme/web"},
+			wantRepos: []string{"acme/web"},
+			wantErr:   assert.NoError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			registry := NewMemoryRepoRegistry()
+			for _, name := range tt.existing {
+				assert.NoError(t, registry.Add(ctx, InstalledRepo{InstallationID: 1, FullName: name}))
+			}
+			teardown := &recordingTeardown{err: tt.teardownErr}
+			// onboarding is disabled, so reaching the GitHub API would panic.
+			h := &InstallationHandler{
+				Registry: registry,
+				Teardown: teardown,
+				Policy:   &InstallationPolicy{DenyRepos: []string{"acme/legacy"}},
+			}
+			tt.wantErr(t, h.Handle(ctx, tt.eventType, "delivery", []byte(tt.payload)))
+
+			repos, err := registry.List(ctx, 1)
+			assert.NoError(t, err)
+			var names []string
+			for _, repo := range repos {
+				names = append(names, repo.FullName)
+			}
+			assert.Equal(t, tt.wantRepos, names)
+			assert.Equal(t, tt.wantTeardowns, teardown.repos)
+		})
+	}
+}
+
+func TestPreviewTeardown(t *testing.T) {
+	ctx := context.Background()
+	provisioner := business.NewMemoryProvisioner()
+	heads := NewMemoryHeadStore(time.Hour)
+	for _, p := range []business.Preview{
+		{Owner: "Acme", Repo: "Web", Number: 1, HeadSHA: "a"},
+		{Owner: "acme", Repo: "web", Number: 2, HeadSHA: "b"},
+		{Owner: "acme", Repo: "web-api", Number: 1, HeadSHA: "c"},
+	} {
+		assert.NoError(t, provisioner.Deploy(ctx, nil, p))
+		_, err := heads.Advance(ctx, PRLockKey(p.Owner+"/"+p.Repo, p.Number), p.HeadSHA, time.Now())
+		assert.NoError(t, err)
+	}
+
+	teardown := &PreviewTeardown{Provisioner: provisioner, Supersede: &Superseder{Heads: heads}}
+	assert.NoError(t, teardown.TeardownRepo(ctx, InstalledRepo{InstallationID: 1, FullName: "acme/web"}))
+
+	numbers, err := provisioner.Previews(ctx, "acme", "web")
+	assert.NoError(t, err)
+	assert.Empty(t, numbers)
+	numbers, err = provisioner.Previews(ctx, "acme", "web-api")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1}, numbers)
+	assert.NotContains(t, heads.heads, PRLockKey("acme/web", 1))
+	assert.NotContains(t, heads.heads, PRLockKey("acme/web", 2))
+	assert.Contains(t, heads.heads, PRLockKey("acme/web-api", 1))
+
+	// provisioners that cannot list previews have nothing to tear down.
+	assert.NoError(t, (&PreviewTeardown{}).TeardownRepo(ctx, InstalledRepo{InstallationID: 1, FullName: "acme/web"}))
+}
@@ -0,0 +1,240 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/rs/zerolog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lock backends selectable in the configuration.
+const (
+	MemoryLockBackend   = "memory"
+	DynamoDBLockBackend = "dynamodb"
+)
+
+// ErrLockHeld is returned when a lock stays busy for longer than the caller
+// is willing to wait.
+var ErrLockHeld = errors.New("lock is held by another worker")
+
+// Locker hands out leases on named locks. A lease that is not extended
+// expires, so a crashed holder cannot block a lock forever. Owners are
+// opaque tokens identifying the holder.
+type Locker interface {
+	// TryLock takes the lock unless another owner holds a live lease, and
+	// reports whether it did.
+	TryLock(ctx context.Context, key, owner string, lease time.Duration) (bool, error)
+	// Extend renews the lease if owner still holds it, and reports whether
+	// it did.
+	Extend(ctx context.Context, key, owner string, lease time.Duration) (bool, error)
+	// Unlock releases the lock if owner still holds it.
+	Unlock(ctx context.Context, key, owner string) error
+}
+
+type memoryLease struct {
+	owner   string
+	expires time.Time
+}
+
+// MemoryLocker keeps leases in process memory, which serializes work within
+// a single server.
+type MemoryLocker struct {
+	mu     sync.Mutex
+	leases map[string]memoryLease
+	now    func() time.Time
+}
+
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{
+		leases: make(map[string]memoryLease),
+		now:    time.Now,
+	}
+}
+
+// held returns the live lease on key. Callers must hold mu.
+func (l *MemoryLocker) held(key string) (memoryLease, bool) {
+	lease, ok := l.leases[key]
+	if ok && !l.now().Before(lease.expires) {
+		delete(l.leases, key)
+		return memoryLease{}, false
+	}
+	return lease, ok
+}
+
+func (l *MemoryLocker) TryLock(ctx context.Context, key, owner string, lease time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.held(key); ok {
+		return false, nil
+	}
+	l.leases[key] = memoryLease{owner: owner, expires: l.now().Add(lease)}
+	return true, nil
+}
+
+func (l *MemoryLocker) Extend(ctx context.Context, key, owner string, lease time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current, ok := l.held(key); !ok || current.owner != owner {
+		return false, nil
+	}
+	l.leases[key] = memoryLease{owner: owner, expires: l.now().Add(lease)}
+	return true, nil
+}
+
+func (l *MemoryLocker) Unlock(ctx context.Context, key, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current, ok := l.held(key); ok && current.owner == owner {
+		delete(l.leases, key)
+	}
+	return nil
+}
+
+// DynamoDBLocker keeps leases in a DynamoDB-style table. Conditional writes
+// on the owner make it safe across concurrent Lambda invocations, and the
+// table's TTL attribute expires abandoned leases.
+type DynamoDBLocker struct {
+	table DynamoTable
+	now   func() time.Time
+}
+
+func NewDynamoDBLocker(table DynamoTable) *DynamoDBLocker {
+	return &DynamoDBLocker{table: table, now: time.Now}
+}
+
+func (l *DynamoDBLocker) key(key string) string {
+	return "lock#" + key
+}
+
+func (l *DynamoDBLocker) TryLock(ctx context.Context, key, owner string, lease time.Duration) (bool, error) {
+	return l.table.PutItemIfAbsent(ctx, DynamoItem{
+		Key:       l.key(key),
+		Value:     owner,
+		ExpiresAt: l.now().Add(lease),
+	})
+}
+
+func (l *DynamoDBLocker) Extend(ctx context.Context, key, owner string, lease time.Duration) (bool, error) {
+	return l.table.PutItemIfValue(ctx, DynamoItem{
+		Key:       l.key(key),
+		Value:     owner,
+		ExpiresAt: l.now().Add(lease),
+	}, owner)
+}
+
+func (l *DynamoDBLocker) Unlock(ctx context.Context, key, owner string) error {
+	_, err := l.table.DeleteItemIfValue(ctx, l.key(key), owner)
+	return err
+}
+
+// PRLocks serializes work on individual pull requests, so racing events for
+// the same pull request cannot interleave their changes.
+type PRLocks struct {
+	Locker Locker
+	// Lease is how long a lock survives without being renewed. Holders renew
+	// it in the background while they work.
+	Lease time.Duration
+	// Wait is how long to wait for a busy lock before giving up.
+	Wait time.Duration
+	// PollInterval is how often a busy lock is retried.
+	PollInterval time.Duration
+}
+
+// PRLockKey identifies the lock of a pull request.
+func PRLockKey(repo string, number int) string {
+	return fmt.Sprintf("pr#%s#%d", strings.ToLower(repo), number)
+}
+
+// Lock waits until the pull request's lock is held and returns a context
+// for the work done under it, plus a function releasing it. The context is
+// cancelled if the lease is lost. A nil PRLocks does not lock anything.
+func (l *PRLocks) Lock(ctx context.Context, repo string, number int) (context.Context, func(), error) {
+	if l == nil {
+		return ctx, func() {}, nil
+	}
+	key := PRLockKey(repo, number)
+	owner, err := newLockOwner()
+	if err != nil {
+		return ctx, nil, err
+	}
+	logger := zerolog.Ctx(ctx).With().Str("lock", key).Logger()
+
+	deadline := time.NewTimer(l.Wait)
+	defer deadline.Stop()
+	for {
+		ok, err := l.Locker.TryLock(ctx, key, owner, l.Lease)
+		if err != nil {
+			return ctx, nil, err
+		}
+		if ok {
+			break
+		}
+		logger.Debug().Msg("waiting for pull request lock")
+		select {
+		case <-ctx.Done():
+			return ctx, nil, ctx.Err()
+		case <-deadline.C:
+			return ctx, nil, business.Retryable(fmt.Errorf("%s: %w", key, ErrLockHeld))
+		case <-time.After(l.PollInterval):
+		}
+	}
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go l.renew(lockCtx, cancel, done, key, owner)
+	var once sync.Once
+	unlock := func() {
+		once.Do(func() {
+			close(done)
+			cancel()
+			// the work context may already be cancelled, so release with a
+			// fresh one.
+			if err := l.Locker.Unlock(context.Background(), key, owner); err != nil {
+				logger.Err(err).Msg("failed to release pull request lock")
+			}
+		})
+	}
+	return lockCtx, unlock, nil
+}
+
+// renew extends the lease until done is closed, cancelling the work if the
+// lease is lost.
+func (l *PRLocks) renew(ctx context.Context, cancel context.CancelFunc, done <-chan struct{}, key, owner string) {
+	ticker := time.NewTicker(l.Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := l.Locker.Extend(ctx, key, owner, l.Lease)
+			if err != nil {
+				// a failed renewal is retried on the next tick; the lease
+				// is still valid until it expires.
+				zerolog.Ctx(ctx).Warn().Err(err).Str("lock", key).Msg("failed to renew pull request lock")
+				continue
+			}
+			if !ok {
+				zerolog.Ctx(ctx).Warn().Str("lock", key).Msg("lost pull request lock")
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+func newLockOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
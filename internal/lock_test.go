@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func lockers(clock *fakeClock) map[string]Locker {
+	mem := NewMemoryLocker()
+	mem.now = clock.now
+	table := NewMemoryDynamoTable()
+	table.now = clock.now
+	dynamo := NewDynamoDBLocker(table)
+	dynamo.now = clock.now
+	return map[string]Locker{
+		"memory":   mem,
+		"dynamodb": dynamo,
+	}
+}
+
+func TestLockers(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Now()}
+	for name, locker := range lockers(clock) {
+		t.Run(name, func(t *testing.T) {
+			ok, err := locker.TryLock(ctx, "pr", "a", time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, ok, "first lock")
+
+			ok, err = locker.TryLock(ctx, "pr", "b", time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, ok, "lock held by another owner")
+
+			ok, err = locker.Extend(ctx, "pr", "b", time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, ok, "extend by another owner")
+
+			// unlocking someone else's lease does nothing.
+			assert.NoError(t, locker.Unlock(ctx, "pr", "b"))
+			ok, err = locker.TryLock(ctx, "pr", "b", time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, ok, "lock after foreign unlock")
+
+			assert.NoError(t, locker.Unlock(ctx, "pr", "a"))
+			ok, err = locker.TryLock(ctx, "pr", "b", time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, ok, "lock after unlock")
+		})
+	}
+}
+
+func TestLockers_expiry(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+	clock := &fakeClock{t: start}
+	for name, locker := range lockers(clock) {
+		t.Run(name, func(t *testing.T) {
+			clock.t = start
+			ok, err := locker.TryLock(ctx, "pr", "a", time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			clock.t = start.Add(50 * time.Second)
+			ok, err = locker.Extend(ctx, "pr", "a", time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, ok, "extend live lease")
+
+			clock.t = start.Add(100 * time.Second)
+			ok, err = locker.TryLock(ctx, "pr", "b", time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, ok, "extended lease is still live")
+
+			clock.t = start.Add(200 * time.Second)
+			ok, err = locker.Extend(ctx, "pr", "a", time.Minute)
+			assert.NoError(t, err)
+			assert.False(t, ok, "extend expired lease")
+			ok, err = locker.TryLock(ctx, "pr", "b", time.Minute)
+			assert.NoError(t, err)
+			assert.True(t, ok, "lock expired lease")
+		})
+	}
+}
+
+func TestPRLocks_Lock(t *testing.T) {
+	ctx := context.Background()
+	locks := &PRLocks{
+		Locker:       NewMemoryLocker(),
+		Lease:        time.Minute,
+		Wait:         50 * time.Millisecond,
+		PollInterval: 5 * time.Millisecond,
+	}
+	_, unlock, err := locks.Lock(ctx, "acme/web", 1)
+	assert.NoError(t, err)
+
+	_, _, err = locks.Lock(ctx, "ACME/web", 1)
+	assert.True(t, errors.Is(err, ErrLockHeld), "busy lock times out")
+	assert.Equal(t, business.RetryableError, business.Classify(err))
+
+	_, unlockOther, err := locks.Lock(ctx, "acme/web", 2)
+	assert.NoError(t, err, "other pull requests are not blocked")
+	unlockOther()
+
+	// a waiter gets the lock once it is released.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		unlock()
+	}()
+	_, unlock, err = locks.Lock(ctx, "acme/web", 1)
+	assert.NoError(t, err)
+	unlock()
+	unlock()
+}
+
+func TestPRLocks_Lock_lostLease(t *testing.T) {
+	locker := NewMemoryLocker()
+	locks := &PRLocks{Locker: locker, Lease: 30 * time.Millisecond, Wait: time.Second, PollInterval: time.Millisecond}
+	ctx, unlock, err := locks.Lock(context.Background(), "acme/web", 1)
+	assert.NoError(t, err)
+	defer unlock()
+
+	// another worker steals the lock after the lease is broken.
+	locker.mu.Lock()
+	delete(locker.leases, PRLockKey("acme/web", 1))
+	locker.mu.Unlock()
+	ok, err := locker.TryLock(context.Background(), PRLockKey("acme/web", 1), "thief", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("work context was not cancelled after losing the lease")
+	}
+}
+
+func TestPRLocks_Lock_nil(t *testing.T) {
+	var locks *PRLocks
+	ctx := context.Background()
+	got, unlock, err := locks.Lock(ctx, "acme/web", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, ctx, got)
+	unlock()
+}
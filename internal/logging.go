@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+	"strconv"
+	"strings"
+)
+
+// RedactedValue replaces redacted payload fields.
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactPaths cover the free text and email fields of the events the
+// app subscribes to.
+var DefaultRedactPaths = []string{
+	"pull_request.body",
+	"pull_request.user.email",
+	"issue.body",
+	"comment.body",
+	"sender.email",
+	"head_commit.author.email",
+	"head_commit.committer.email",
+	"commits.*.author.email",
+	"commits.*.committer.email",
+}
+
+// PayloadLoggingHandler logs webhook payloads before passing them on, with
+// the fields at RedactPaths replaced. Paths are dot separated JSON keys,
+// optionally prefixed with "$.", where "*" matches any key or array index.
+// It is meant for debugging and is not installed by default.
+type PayloadLoggingHandler struct {
+	Handler     githubapp.EventHandler
+	RedactPaths []string
+}
+
+func (h *PayloadLoggingHandler) Handles() []string {
+	return h.Handler.Handles()
+}
+
+func (h *PayloadLoggingHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	logger := zerolog.Ctx(ctx).With().
+		Str("event", eventType).
+		Str("delivery", deliveryID).
+		Logger()
+	redacted, err := RedactPayload(payload, h.RedactPaths)
+	if err != nil {
+		logger.Warn().Err(err).Msg("could not redact webhook payload for logging")
+	} else {
+		logger.Info().RawJSON("payload", redacted).Msg("webhook payload")
+	}
+	return h.Handler.Handle(ctx, eventType, deliveryID, payload)
+}
+
+// RedactPayload returns payload with the values at paths replaced by
+// RedactedValue.
+func RedactPayload(payload []byte, paths []string) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		p = strings.TrimPrefix(p, "$.")
+		if p == "" {
+			continue
+		}
+		doc = redact(doc, strings.Split(p, "."))
+	}
+	return json.Marshal(doc)
+}
+
+func redact(node interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return RedactedValue
+	}
+	key, rest := path[0], path[1:]
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if key == "*" || key == k {
+				v[k] = redact(child, rest)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			if key == "*" || key == strconv.Itoa(i) {
+				v[i] = redact(child, rest)
+			}
+		}
+	}
+	return node
+}
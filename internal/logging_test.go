@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRedactPayload(t *testing.T) {
+	payload := `{
+		"action": "opened",
+		"pull_request": {"number": 1, "body": "secret plans", "user": {"login": "octocat", "email": "octocat@example.com"}},
+		"commits": [{"id": "a", "author": {"email": "a@example.com"}}, {"id": "b", "author": {"email": "b@example.com"}}]
+	}`
+	tests := []struct {
+		name    string
+		payload string
+		paths   []string
+		want    string
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "default paths",
+			payload: payload,
+			paths:   DefaultRedactPaths,
+			want: `{
+				"action": "opened",
+				"pull_request": {"number": 1, "body": "[REDACTED]", "user": {"login": "octocat", "email": "[REDACTED]"}},
+				"commits": [{"id": "a", "author": {"email": "[REDACTED]"}}, {"id": "b", "author": {"email": "[REDACTED]"}}]
+			}`,
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "root prefix and array index",
+			payload: payload,
+			paths:   []string{"$.commits.1.id", "$.pull_request.user"},
+			want: `{
+				"action": "opened",
+				"pull_request": {"number": 1, "body": "secret plans", "user": "[REDACTED]"},
+				"commits": [{"id": "a", "author": {"email": "a@example.com"}}, {"id": "[REDACTED]", "author": {"email": "b@example.com"}}]
+			}`,
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "missing path is ignored",
+			payload: `{"action": "opened"}`,
+			paths:   []string{"pull_request.body", ""},
+			want:    `{"action": "opened"}`,
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "invalid json",
+			payload: `{"action":`,
+			wantErr: assert.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RedactPayload([]byte(tt.payload), tt.paths)
+			if !tt.wantErr(t, err) || err != nil {
+				return
+			}
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestPayloadLoggingHandler_Handle(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := zerolog.New(&buf).WithContext(context.Background())
+	inner := &countingHandler{}
+	h := &PayloadLoggingHandler{Handler: inner, RedactPaths: []string{"pull_request.body"}}
+	assert.Equal(t, inner.Handles(), h.Handles())
+
+	payload := `{"pull_request": {"body": "secret plans"}}`
+	assert.NoError(t, h.Handle(ctx, "pull_request", "a", []byte(payload)))
+	assert.Equal(t, 1, inner.calls)
+	assert.Contains(t, buf.String(), RedactedValue)
+	assert.NotContains(t, buf.String(), "secret plans")
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrObjectNotFound is returned when an object does not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is the subset of an S3-compatible bucket the app uses. Keys
+// are slash separated paths.
+type ObjectStore interface {
+	PutObject(ctx context.Context, key string, body []byte) error
+	GetObject(ctx context.Context, key string) ([]byte, error)
+	// ListObjects returns the keys starting with prefix in lexical order.
+	ListObjects(ctx context.Context, prefix string) ([]string, error)
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// LocalObjectStore is a local stand-in for a bucket that keeps each object
+// as a file under a root directory.
+type LocalObjectStore struct {
+	root string
+}
+
+func NewLocalObjectStore(root string) (*LocalObjectStore, error) {
+	if err := os.MkdirAll(root, 0o700); err != nil {
+		return nil, err
+	}
+	return &LocalObjectStore{root: root}, nil
+}
+
+// path maps a key to a file, refusing keys that would escape the root.
+func (s *LocalObjectStore) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || strings.HasSuffix(key, "/") {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalObjectStore) PutObject(ctx context.Context, key string, body []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	// write to a temporary file first so readers never see partial objects.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *LocalObjectStore) GetObject(ctx context.Context, key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(p); err == nil && info.IsDir() {
+		// directories only hold the objects under a prefix, like in a bucket.
+		return nil, fmt.Errorf("%s: %w", key, ErrObjectNotFound)
+	}
+	b, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", key, ErrObjectNotFound)
+	}
+	return b, err
+}
+
+func (s *LocalObjectStore) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+func (s *LocalObjectStore) DeleteObject(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
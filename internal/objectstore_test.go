@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalObjectStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := NewLocalObjectStore(root)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.PutObject(ctx, "a/one.json", []byte("1")))
+	assert.NoError(t, store.PutObject(ctx, "a/two.json", []byte("2")))
+	assert.NoError(t, store.PutObject(ctx, "b/three.json", []byte("3")))
+	assert.NoError(t, store.PutObject(ctx, "a/one.json", []byte("one")))
+
+	got, err := store.GetObject(ctx, "a/one.json")
+	assert.NoError(t, err)
+	assert.Equal(t, "one", string(got))
+
+	keys, err := store.ListObjects(ctx, "a/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/one.json", "a/two.json"}, keys)
+
+	assert.NoError(t, store.DeleteObject(ctx, "a/one.json"))
+	assert.NoError(t, store.DeleteObject(ctx, "a/one.json"))
+	_, err = store.GetObject(ctx, "a/one.json")
+	assert.True(t, errors.Is(err, ErrObjectNotFound))
+}
+
+func TestLocalObjectStore_keysStayInRoot(t *testing.T) {
+	ctx := context.Background()
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	store, err := NewLocalObjectStore(root)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.PutObject(ctx, "../../escape.txt", []byte("x")))
+	_, err = os.Stat(filepath.Join(parent, "escape.txt"))
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+	_, err = os.Stat(filepath.Join(root, "escape.txt"))
+	assert.NoError(t, err)
+
+	assert.Error(t, store.PutObject(ctx, "dir/", []byte("x")))
+	assert.Error(t, store.PutObject(ctx, "", []byte("x")))
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"sync"
+	"time"
+)
+
+// InstallationPermissionCache looks up the permissions installations granted
+// the app with the app's own credentials, and keeps them for a while so
+// every event does not cost an extra API call.
+type InstallationPermissionCache struct {
+	clientCreator githubapp.ClientCreator
+	ttl           time.Duration
+
+	mu      sync.Mutex
+	entries map[int64]permissionEntry
+	now     func() time.Time
+}
+
+func NewInstallationPermissionCache(cc githubapp.ClientCreator, ttl time.Duration) *InstallationPermissionCache {
+	return &InstallationPermissionCache{
+		clientCreator: cc,
+		ttl:           ttl,
+		entries:       make(map[int64]permissionEntry),
+		now:           time.Now,
+	}
+}
+
+type permissionEntry struct {
+	permissions *github.InstallationPermissions
+	expires     time.Time
+}
+
+func (c *InstallationPermissionCache) Permissions(ctx context.Context, installationID int64) (*github.InstallationPermissions, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[installationID]
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		return entry.permissions, nil
+	}
+
+	client, err := c.clientCreator.NewAppClient()
+	if err != nil {
+		return nil, err
+	}
+	installation, _, err := client.Apps.GetInstallation(ctx, installationID)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[installationID] = permissionEntry{
+		permissions: installation.GetPermissions(),
+		expires:     c.now().Add(c.ttl),
+	}
+	return installation.GetPermissions(), nil
+}
+
+// Forget drops the cached permissions of an installation, once they changed
+// or the app was uninstalled.
+func (c *InstallationPermissionCache) Forget(installationID int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, installationID)
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// appClientCreator only creates app clients, counting the installation
+// lookups they make.
+type appClientCreator struct {
+	githubapp.ClientCreator
+	lookups int
+}
+
+func (c *appClientCreator) NewAppClient() (*github.Client, error) {
+	return github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatchHandler(mock.GetAppInstallationsByInstallationId, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.lookups++
+			w.Write(mock.MustMarshal(github.Installation{
+				Permissions: &github.InstallationPermissions{Statuses: github.String("write")},
+			}))
+		})),
+	)), nil
+}
+
+func TestInstallationPermissionCache(t *testing.T) {
+	ctx := context.Background()
+	cc := &appClientCreator{}
+	now := time.Now()
+	cache := NewInstallationPermissionCache(cc, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	perms, err := cache.Permissions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "write", perms.GetStatuses())
+	_, err = cache.Permissions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cc.lookups, "cached permissions are reused")
+
+	cache.Forget(1)
+	_, err = cache.Permissions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cc.lookups, "forgotten permissions are looked up again")
+
+	now = now.Add(2 * time.Minute)
+	_, err = cache.Permissions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, cc.lookups, "expired permissions are looked up again")
+}
@@ -3,21 +3,47 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/ehenry2/gh-app-pr-hello/business"
 	"github.com/google/go-github/v47/github"
 	"github.com/palantir/go-githubapp/githubapp"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 const (
-	OpenedAction = "opened"
-	ClosedAction = "closed"
+	OpenedAction           = "opened"
+	ClosedAction           = "closed"
+	ReopenedAction         = "reopened"
+	SynchronizeAction      = "synchronize"
+	ReadyForReviewAction   = "ready_for_review"
+	ConvertedToDraftAction = "converted_to_draft"
+	LabeledAction          = "labeled"
+	UnlabeledAction        = "unlabeled"
+	EditedAction           = "edited"
 )
 
 type PRHandler struct {
-	ClientCreator githubapp.ClientCreator
-	OpenHandler   *business.PROpenHandler
-	CloseHandler  *business.PRCloseHandler
+	ClientCreator           githubapp.ClientCreator
+	OpenHandler             *business.PROpenHandler
+	CloseHandler            *business.PRCloseHandler
+	ReopenHandler           *business.PRReopenHandler
+	SynchronizeHandler      *business.PRSynchronizeHandler
+	ReadyForReviewHandler   *business.PRReadyForReviewHandler
+	ConvertedToDraftHandler *business.PRConvertedToDraftHandler
+	LabeledHandler          *business.PRLabeledHandler
+	UnlabeledHandler        *business.PRUnlabeledHandler
+	EditedHandler           *business.PREditedHandler
+	// Filter skips events before any handler runs. All events are processed
+	// when it is nil.
+	Filter *business.EventFilter
+	// Policy limits the installations and repositories the app acts on.
+	Policy *InstallationPolicy
+	// Locks serializes events for the same pull request. Events run
+	// concurrently when it is nil.
+	Locks *PRLocks
+	// Supersede skips and cancels deployments of outdated heads. Every
+	// event is processed when it is nil.
+	Supersede *Superseder
 }
 
 func (h *PRHandler) Handles() []string {
@@ -25,30 +51,97 @@ func (h *PRHandler) Handles() []string {
 }
 
 func (h *PRHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
-	log.Info().Msg("handling github event")
-	log.Info().Msg(string(payload))
 	// parse json body of event.
 	var event github.PullRequestEvent
 	if err := json.Unmarshal(payload, &event); err != nil {
-		log.Err(err).Msg("failed to decode json")
+		zerolog.Ctx(ctx).Err(err).Str("delivery", deliveryID).Msg("failed to decode json")
+		return business.Permanent(err)
+	}
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	logger := zerolog.Ctx(ctx).With().
+		Str("delivery", deliveryID).
+		Str("action", event.GetAction()).
+		Str("repo", event.GetRepo().GetFullName()).
+		Int("pr", event.GetNumber()).
+		Str("sha", event.GetPullRequest().GetHead().GetSHA()).
+		Str("sender", event.GetSender().GetLogin()).
+		Int64("installation", installationID).
+		Logger()
+	ctx = logger.WithContext(ctx)
+	if reason := h.Policy.Check(installationID, event.GetRepo()); reason != "" {
+		logger.Info().Str("skip_reason", reason).Msg("ignoring event outside the installation policy")
+		return nil
+	}
+	logger.Info().Msg("handling pull request event")
+
+	// skip events the filter rules exclude.
+	if h.Filter != nil {
+		if reason := h.Filter.Check(event); reason != "" {
+			logger.Info().Str("skip_reason", reason).Msg("skipping filtered pull request event")
+			return nil
+		}
+	}
+
+	// skip work for heads that a newer push replaced.
+	run, err := h.Supersede.Begin(ctx, event)
+	if err != nil {
+		logger.Err(err).Msg("failed to record pull request head")
 		return err
 	}
+	if run.Stale() {
+		logger.Info().Msg("skipping event for a superseded head")
+		return nil
+	}
+	defer run.Done()
+
+	err = h.handle(run.Context(), installationID, event)
+	if err != nil && run.Superseded() {
+		logger.Info().Err(err).Msg("abandoned event for a superseded head")
+		return business.Ignored(fmt.Errorf("%s: %w", event.GetPullRequest().GetHead().GetSHA(), ErrSuperseded))
+	}
+	return err
+}
+
+func (h *PRHandler) handle(ctx context.Context, installationID int64, event github.PullRequestEvent) error {
+	logger := zerolog.Ctx(ctx)
+
+	// wait for other events on the same pull request to finish.
+	ctx, unlock, err := h.Locks.Lock(ctx, event.GetRepo().GetFullName(), event.GetNumber())
+	if err != nil {
+		logger.Err(err).Msg("failed to lock pull request")
+		return err
+	}
+	defer unlock()
 
 	// create github api client to use in posting the comment.
-	installationID := githubapp.GetInstallationIDFromEvent(&event)
 	client, err := h.ClientCreator.NewInstallationClient(installationID)
 	if err != nil {
-		log.Err(err).Msg("failed to create installation client")
+		logger.Err(err).Msg("failed to create installation client")
 		return err
 	}
 
 	// handle the event.
-	switch *event.Action {
+	switch event.GetAction() {
 	case OpenedAction:
 		return h.OpenHandler.Handle(ctx, client, event)
 	case ClosedAction:
 		return h.CloseHandler.Handle(ctx, client, event)
+	case ReopenedAction:
+		return h.ReopenHandler.Handle(ctx, client, event)
+	case SynchronizeAction:
+		return h.SynchronizeHandler.Handle(ctx, client, event)
+	case ReadyForReviewAction:
+		return h.ReadyForReviewHandler.Handle(ctx, client, event)
+	case ConvertedToDraftAction:
+		return h.ConvertedToDraftHandler.Handle(ctx, client, event)
+	case LabeledAction:
+		return h.LabeledHandler.Handle(ctx, client, event)
+	case UnlabeledAction:
+		return h.UnlabeledHandler.Handle(ctx, client, event)
+	case EditedAction:
+		return h.EditedHandler.Handle(ctx, client, event)
 	}
 
-	return err
+	logger.Info().Msg("ignoring unhandled pull request action")
+	return nil
 }
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"context"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPRHandler_Handle(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:    "invalid json",
+			payload: `{"action":`,
+			wantErr: assert.Error,
+		},
+		{
+			name:    "installation outside the policy",
+			payload: `{"action": "opened", "number": 1, "installation": {"id": 2}, "repository": {"full_name": "acme/web", "owner": {"login": "acme"}}, "pull_request": {"number": 1}}`,
+			wantErr: assert.NoError,
+		},
+		{
+			name:    "filtered bot event",
+			payload: `{"action": "opened", "number": 1, "sender": {"login": "dependabot[bot]", "type": "Bot"}, "pull_request": {"number": 1}}`,
+			wantErr: assert.NoError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// no client creator is configured, so reaching the GitHub API would panic.
+			h := &PRHandler{
+				Filter: &business.EventFilter{SkipBots: true, Registry: metrics.NewRegistry()},
+				Policy: &InstallationPolicy{AllowInstallations: []int64{0, 1}},
+			}
+			tt.wantErr(t, h.Handle(context.Background(), "pull_request", "delivery", []byte(tt.payload)))
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/palantir/go-githubapp/githubapp"
+	"net/http"
+)
+
+const (
+	MemoryQueueBackend = "memory"
+	SQSQueueBackend    = "sqs"
+)
+
+// Delivery is a validated webhook delivery waiting to be processed.
+type Delivery struct {
+	EventType  string          `json:"eventType"`
+	DeliveryID string          `json:"deliveryId"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// Queue accepts deliveries for background processing.
+type Queue interface {
+	Enqueue(ctx context.Context, d Delivery) error
+}
+
+// MemoryQueue is a bounded in-process queue for server mode.
+type MemoryQueue struct {
+	deliveries chan Delivery
+}
+
+func NewMemoryQueue(size int) *MemoryQueue {
+	return &MemoryQueue{deliveries: make(chan Delivery, size)}
+}
+
+// Enqueue adds a delivery without blocking. A full queue is reported as
+// githubapp.ErrCapacityExceeded so the dispatcher answers with a 503.
+func (q *MemoryQueue) Enqueue(ctx context.Context, d Delivery) error {
+	select {
+	case q.deliveries <- d:
+		return nil
+	default:
+		return fmt.Errorf("memory queue: %w", githubapp.ErrCapacityExceeded)
+	}
+}
+
+// Deliveries returns the channel workers consume from.
+func (q *MemoryQueue) Deliveries() <-chan Delivery {
+	return q.deliveries
+}
+
+// SQSSender is the subset of an SQS client needed to enqueue a message.
+type SQSSender interface {
+	SendMessage(ctx context.Context, queueURL, body string) error
+}
+
+// SQSSendMessageAPI is the subset of the SQS client SQSClientSender uses.
+type SQSSendMessageAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// SQSClientSender sends messages through an SQS client.
+type SQSClientSender struct {
+	Client SQSSendMessageAPI
+}
+
+func (s *SQSClientSender) SendMessage(ctx context.Context, queueURL, body string) error {
+	_, err := s.Client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(queueURL),
+		MessageBody: aws.String(body),
+	})
+	return err
+}
+
+// SQSQueue sends deliveries to an SQS queue as JSON message bodies, to be
+// consumed by the worker Lambda.
+type SQSQueue struct {
+	Sender   SQSSender
+	QueueURL string
+}
+
+func (q *SQSQueue) Enqueue(ctx context.Context, d Delivery) error {
+	body, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return q.Sender.SendMessage(ctx, q.QueueURL, string(body))
+}
+
+// QueueScheduler is a githubapp.Scheduler that hands validated deliveries to
+// a Queue instead of running the handler inline.
+type QueueScheduler struct {
+	Queue Queue
+}
+
+func (s *QueueScheduler) Schedule(ctx context.Context, d githubapp.Dispatch) error {
+	return s.Queue.Enqueue(ctx, Delivery{
+		EventType:  d.EventType,
+		DeliveryID: d.DeliveryID,
+		Payload:    d.Payload,
+	})
+}
+
+// AcceptedResponseCallback answers queued deliveries with 202 Accepted,
+// since their outcome is not known when the webhook returns.
+func AcceptedResponseCallback(w http.ResponseWriter, r *http.Request, event string, handled bool) {
+	if event == "ping" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
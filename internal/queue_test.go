@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type recordingSender struct {
+	queueURL string
+	bodies   []string
+}
+
+func (s *recordingSender) SendMessage(ctx context.Context, queueURL, body string) error {
+	s.queueURL = queueURL
+	s.bodies = append(s.bodies, body)
+	return nil
+}
+
+func signedWebhookRequest(t *testing.T, secret, eventType, deliveryID, payload string) *http.Request {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	req, err := http.NewRequest(http.MethodPost, "https://localhost/default/api/github/hook", bytes.NewBufferString(payload))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", eventType)
+	req.Header.Set("X-GitHub-Delivery", deliveryID)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func TestMemoryQueue_Enqueue(t *testing.T) {
+	ctx := context.Background()
+	q := NewMemoryQueue(1)
+	assert.NoError(t, q.Enqueue(ctx, Delivery{DeliveryID: "a"}))
+	err := q.Enqueue(ctx, Delivery{DeliveryID: "b"})
+	assert.True(t, errors.Is(err, githubapp.ErrCapacityExceeded))
+	assert.Equal(t, "a", (<-q.Deliveries()).DeliveryID)
+}
+
+func TestSQSQueue_Enqueue(t *testing.T) {
+	sender := &recordingSender{}
+	q := &SQSQueue{Sender: sender, QueueURL: "https://sqs.example.com/queue"}
+	d := Delivery{EventType: "pull_request", DeliveryID: "a", Payload: json.RawMessage(`{"action":"opened"}`)}
+	assert.NoError(t, q.Enqueue(context.Background(), d))
+	assert.Equal(t, "https://sqs.example.com/queue", sender.queueURL)
+	assert.Len(t, sender.bodies, 1)
+	var got Delivery
+	assert.NoError(t, json.Unmarshal([]byte(sender.bodies[0]), &got))
+	assert.Equal(t, d, got)
+}
+
+type fakeSQS struct {
+	input *sqs.SendMessageInput
+}
+
+func (f *fakeSQS) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.input = params
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func TestSQSClientSender_SendMessage(t *testing.T) {
+	client := &fakeSQS{}
+	sender := &SQSClientSender{Client: client}
+	assert.NoError(t, sender.SendMessage(context.Background(), "https://sqs.example.com/queue", `{"deliveryId":"a"}`))
+	assert.Equal(t, "https://sqs.example.com/queue", aws.ToString(client.input.QueueUrl))
+	assert.Equal(t, `{"deliveryId":"a"}`, aws.ToString(client.input.MessageBody))
+}
+
+func TestQueueScheduler_dispatcher(t *testing.T) {
+	q := NewMemoryQueue(1)
+	handler := &countingHandler{}
+	dispatcher := githubapp.NewEventDispatcher(
+		[]githubapp.EventHandler{handler},
+		"secret",
+		githubapp.WithScheduler(&QueueScheduler{Queue: q}),
+		githubapp.WithResponseCallback(AcceptedResponseCallback),
+	)
+
+	w := httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, signedWebhookRequest(t, "secret", "pull_request", "a", `{"action":"opened"}`))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, 0, handler.calls, "handler runs in the worker, not the webhook")
+	d := <-q.Deliveries()
+	assert.Equal(t, "pull_request", d.EventType)
+	assert.Equal(t, "a", d.DeliveryID)
+	assert.JSONEq(t, `{"action":"opened"}`, string(d.Payload))
+
+	// fill the queue so the next delivery is rejected.
+	assert.NoError(t, q.Enqueue(context.Background(), Delivery{}))
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, signedWebhookRequest(t, "secret", "pull_request", "b", `{"action":"opened"}`))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w = httptest.NewRecorder()
+	dispatcher.ServeHTTP(w, signedWebhookRequest(t, "wrong", "pull_request", "c", `{"action":"opened"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAcceptedResponseCallback(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	w := httptest.NewRecorder()
+	AcceptedResponseCallback(w, r, "ping", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = httptest.NewRecorder()
+	AcceptedResponseCallback(w, r, "pull_request", true)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+}
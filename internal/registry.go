@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// InstalledRepo is a repository the app is currently installed on.
+type InstalledRepo struct {
+	InstallationID int64     `json:"installation_id"`
+	FullName       string    `json:"full_name"`
+	AddedAt        time.Time `json:"added_at"`
+}
+
+// Owner returns the account owning the repository.
+func (r InstalledRepo) Owner() string {
+	owner, _, _ := strings.Cut(r.FullName, "/")
+	return owner
+}
+
+// Name returns the repository name without its owner.
+func (r InstalledRepo) Name() string {
+	_, name, _ := strings.Cut(r.FullName, "/")
+	return name
+}
+
+// RepoRegistry records which repositories each installation covers, as
+// reported by installation and installation_repositories events.
+type RepoRegistry interface {
+	Add(ctx context.Context, repo InstalledRepo) error
+	Remove(ctx context.Context, installationID int64, fullName string) error
+	// List returns the repositories of an installation sorted by name.
+	List(ctx context.Context, installationID int64) ([]InstalledRepo, error)
+}
+
+// MemoryRepoRegistry keeps the registry in process, for tests and local runs.
+type MemoryRepoRegistry struct {
+	mu    sync.Mutex
+	repos map[int64]map[string]InstalledRepo
+}
+
+func NewMemoryRepoRegistry() *MemoryRepoRegistry {
+	return &MemoryRepoRegistry{repos: make(map[int64]map[string]InstalledRepo)}
+}
+
+func (r *MemoryRepoRegistry) Add(ctx context.Context, repo InstalledRepo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.repos[repo.InstallationID] == nil {
+		r.repos[repo.InstallationID] = make(map[string]InstalledRepo)
+	}
+	r.repos[repo.InstallationID][strings.ToLower(repo.FullName)] = repo
+	return nil
+}
+
+func (r *MemoryRepoRegistry) Remove(ctx context.Context, installationID int64, fullName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.repos[installationID], strings.ToLower(fullName))
+	if len(r.repos[installationID]) == 0 {
+		delete(r.repos, installationID)
+	}
+	return nil
+}
+
+func (r *MemoryRepoRegistry) List(ctx context.Context, installationID int64) ([]InstalledRepo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repos := make([]InstalledRepo, 0, len(r.repos[installationID]))
+	for _, repo := range r.repos[installationID] {
+		repos = append(repos, repo)
+	}
+	sortInstalledRepos(repos)
+	return repos, nil
+}
+
+// ObjectRepoRegistry keeps one object per repository, grouped by
+// installation, in an ObjectStore.
+type ObjectRepoRegistry struct {
+	Objects ObjectStore
+	Prefix  string
+}
+
+func (r *ObjectRepoRegistry) installationPrefix(installationID int64) string {
+	return r.Prefix + strconv.FormatInt(installationID, 10) + "/"
+}
+
+func (r *ObjectRepoRegistry) key(installationID int64, fullName string) string {
+	return r.installationPrefix(installationID) + url.PathEscape(strings.ToLower(fullName)) + ".json"
+}
+
+func (r *ObjectRepoRegistry) Add(ctx context.Context, repo InstalledRepo) error {
+	b, err := json.Marshal(repo)
+	if err != nil {
+		return err
+	}
+	return r.Objects.PutObject(ctx, r.key(repo.InstallationID, repo.FullName), b)
+}
+
+func (r *ObjectRepoRegistry) Remove(ctx context.Context, installationID int64, fullName string) error {
+	return r.Objects.DeleteObject(ctx, r.key(installationID, fullName))
+}
+
+func (r *ObjectRepoRegistry) List(ctx context.Context, installationID int64) ([]InstalledRepo, error) {
+	keys, err := r.Objects.ListObjects(ctx, r.installationPrefix(installationID))
+	if err != nil {
+		return nil, err
+	}
+	repos := make([]InstalledRepo, 0, len(keys))
+	for _, key := range keys {
+		b, err := r.Objects.GetObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		var repo InstalledRepo
+		if err := json.Unmarshal(b, &repo); err != nil {
+			return nil, fmt.Errorf("decoding installed repository %s: %w", key, err)
+		}
+		repos = append(repos, repo)
+	}
+	sortInstalledRepos(repos)
+	return repos, nil
+}
+
+func sortInstalledRepos(repos []InstalledRepo) {
+	sort.Slice(repos, func(i, j int) bool {
+		return repos[i].FullName < repos[j].FullName
+	})
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRepoRegistry(t *testing.T) {
+	objects, err := NewLocalObjectStore(t.TempDir())
+	assert.NoError(t, err)
+	registries := map[string]RepoRegistry{
+		"memory": NewMemoryRepoRegistry(),
+		"object": &ObjectRepoRegistry{Objects: objects, Prefix: "repos/"},
+	}
+	for name, registry := range registries {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			assert.NoError(t, registry.Add(ctx, InstalledRepo{InstallationID: 1, FullName: "acme/web"}))
+			assert.NoError(t, registry.Add(ctx, InstalledRepo{InstallationID: 1, FullName: "acme/api"}))
+			assert.NoError(t, registry.Add(ctx, InstalledRepo{InstallationID: 2, FullName: "initech/web"}))
+
+			repos, err := registry.List(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, []InstalledRepo{
+				{InstallationID: 1, FullName: "acme/api"},
+				{InstallationID: 1, FullName: "acme/web"},
+			}, repos)
+
+			// names are case-insensitive, and removing twice is fine.
+			assert.NoError(t, registry.Remove(ctx, 1, "ACME/web"))
+			assert.NoError(t, registry.Remove(ctx, 1, "acme/web"))
+			repos, err = registry.List(ctx, 1)
+			assert.NoError(t, err)
+			assert.Equal(t, []InstalledRepo{{InstallationID: 1, FullName: "acme/api"}}, repos)
+
+			repos, err = registry.List(ctx, 3)
+			assert.NoError(t, err)
+			assert.Empty(t, repos)
+		})
+	}
+}
+
+func TestInstalledRepo_OwnerName(t *testing.T) {
+	repo := InstalledRepo{FullName: "acme/web"}
+	assert.Equal(t, "acme", repo.Owner())
+	assert.Equal(t, "web", repo.Name())
+}
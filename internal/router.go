@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"context"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog/log"
+)
+
+// Router runs deliveries through the handler registered for their event
+// type, the same way the githubapp dispatcher does for live webhooks.
+type Router struct {
+	handlers map[string]githubapp.EventHandler
+}
+
+func NewRouter(handlers ...githubapp.EventHandler) *Router {
+	r := &Router{handlers: make(map[string]githubapp.EventHandler)}
+	for _, h := range handlers {
+		for _, event := range h.Handles() {
+			r.handlers[event] = h
+		}
+	}
+	return r
+}
+
+// Handles returns the event types with a registered handler.
+func (r *Router) Handles() []string {
+	events := make([]string, 0, len(r.handlers))
+	for event := range r.handlers {
+		events = append(events, event)
+	}
+	return events
+}
+
+func (r *Router) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h, ok := r.handlers[eventType]
+	if !ok {
+		log.Info().Str("event", eventType).Str("delivery", deliveryID).Msg("no handler for event type")
+		return nil
+	}
+	return h.Handle(ctx, eventType, deliveryID, payload)
+}
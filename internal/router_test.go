@@ -0,0 +1,16 @@
+package internal
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRouter_Handle(t *testing.T) {
+	handler := &countingHandler{}
+	r := NewRouter(handler)
+	assert.Equal(t, []string{"pull_request"}, r.Handles())
+	assert.NoError(t, r.Handle(context.Background(), "pull_request", "a", []byte(`{}`)))
+	assert.NoError(t, r.Handle(context.Background(), "push", "b", []byte(`{}`)))
+	assert.Equal(t, 1, handler.calls)
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeS3 keeps the objects of a single bucket in memory and lists them one
+// key per page.
+type fakeS3 struct {
+	objects map[string][]byte
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	b, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.ToString(params.Key)] = b
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	b, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{Message: aws.String("The specified key does not exist.")}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(b))}, nil
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > aws.ToString(params.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		return &s3.ListObjectsV2Output{}, nil
+	}
+	return &s3.ListObjectsV2Output{
+		Contents:              []types.Object{{Key: aws.String(keys[0])}},
+		IsTruncated:           aws.Bool(len(keys) > 1),
+		NextContinuationToken: aws.String(keys[0]),
+	}, nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	delete(f.objects, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestS3ObjectStore(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeS3{objects: map[string][]byte{"other/a/one.json": []byte("x")}}
+	store := &S3ObjectStore{Client: client, Bucket: "previews", Prefix: "dead-letters/"}
+
+	assert.NoError(t, store.PutObject(ctx, "a/one.json", []byte("1")))
+	assert.NoError(t, store.PutObject(ctx, "a/two.json", []byte("2")))
+	assert.NoError(t, store.PutObject(ctx, "b/three.json", []byte("3")))
+	assert.NoError(t, store.PutObject(ctx, "a/one.json", []byte("one")))
+	assert.Contains(t, client.objects, "dead-letters/a/one.json")
+
+	got, err := store.GetObject(ctx, "a/one.json")
+	assert.NoError(t, err)
+	assert.Equal(t, "one", string(got))
+
+	keys, err := store.ListObjects(ctx, "a/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/one.json", "a/two.json"}, keys)
+
+	assert.NoError(t, store.DeleteObject(ctx, "a/one.json"))
+	_, err = store.GetObject(ctx, "a/one.json")
+	assert.True(t, errors.Is(err, ErrObjectNotFound))
+}
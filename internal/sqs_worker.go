@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog/log"
+	"strconv"
+)
+
+// SQSWorker processes batches of queued deliveries in a Lambda function fed
+// by an SQS event source. SQS redelivers failed messages itself, so each
+// message is attempted once per invocation and only failures are reported
+// back through the partial batch response.
+type SQSWorker struct {
+	Handler githubapp.EventHandler
+	// DeadLetters must outlive the Lambda container. Without it, messages
+	// that will not be retried are reported as failed too, and the queue's
+	// redrive policy moves them to its dead-letter queue.
+	DeadLetters DeadLetterStore
+	// MaxAttempts is the number of receives after which a failing message is
+	// moved to the dead-letter store instead of being retried. Permanent
+	// failures are moved there straight away.
+	MaxAttempts int
+}
+
+func (w *SQSWorker) Handle(ctx context.Context, event events.SQSEvent) (events.SQSEventResponse, error) {
+	ctx = log.Logger.WithContext(ctx)
+	var resp events.SQSEventResponse
+	for _, msg := range event.Records {
+		if err := w.handleMessage(ctx, msg); err != nil {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.SQSBatchItemFailure{
+				ItemIdentifier: msg.MessageId,
+			})
+		}
+	}
+	return resp, nil
+}
+
+func (w *SQSWorker) handleMessage(ctx context.Context, msg events.SQSMessage) error {
+	attempts := receiveCount(msg)
+	var d Delivery
+	if err := json.Unmarshal([]byte(msg.Body), &d); err != nil {
+		// retrying cannot fix a malformed message.
+		err = fmt.Errorf("message %s is not a delivery: %w", msg.MessageId, err)
+		d = Delivery{DeliveryID: msg.MessageId, Payload: json.RawMessage(strconv.Quote(msg.Body))}
+		return w.deadLetter(ctx, d, attempts, err)
+	}
+
+	logger := log.With().
+		Str("event", d.EventType).
+		Str("delivery", d.DeliveryID).
+		Str("message", msg.MessageId).
+		Int("attempt", attempts).
+		Logger()
+	err := w.Handler.Handle(logger.WithContext(ctx), d.EventType, d.DeliveryID, d.Payload)
+	if err == nil {
+		return nil
+	}
+	kind := business.Classify(err)
+	if kind == business.IgnoredError {
+		logger.Info().Err(err).Msg("delivery ignored")
+		return nil
+	}
+	logger.Err(err).Str("error_kind", kind.String()).Msg("failed to process delivery")
+	if kind == business.RetryableError && attempts < w.MaxAttempts {
+		return err
+	}
+	return w.deadLetter(ctx, d, attempts, err)
+}
+
+// deadLetter stores a delivery that will not be retried. The message is only
+// reported as failed when it could not be stored, so it is not lost.
+func (w *SQSWorker) deadLetter(ctx context.Context, d Delivery, attempts int, cause error) error {
+	if w.DeadLetters == nil {
+		log.Warn().Err(cause).
+			Str("event", d.EventType).
+			Str("delivery", d.DeliveryID).
+			Int("attempts", attempts).
+			Msg("leaving delivery to the queue's redrive policy")
+		return cause
+	}
+	log.Warn().Err(cause).
+		Str("event", d.EventType).
+		Str("delivery", d.DeliveryID).
+		Int("attempts", attempts).
+		Msg("moving delivery to the dead-letter store")
+	if err := w.DeadLetters.Put(ctx, NewDeadLetter(d, attempts, cause)); err != nil {
+		log.Err(err).Str("delivery", d.DeliveryID).Msg("failed to store dead letter")
+		return err
+	}
+	return nil
+}
+
+// receiveCount returns how many times SQS has delivered the message.
+func receiveCount(msg events.SQSMessage) int {
+	n, err := strconv.Atoi(msg.Attributes["ApproximateReceiveCount"])
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
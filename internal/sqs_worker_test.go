@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type failingDeadLetterStore struct {
+	MemoryDeadLetterStore
+}
+
+func (*failingDeadLetterStore) Put(ctx context.Context, l DeadLetter) error {
+	return errors.New("disk full")
+}
+
+// deliveryHandler fails deliveries whose ID is in fail.
+type deliveryHandler struct {
+	fail map[string]bool
+}
+
+func (h *deliveryHandler) Handles() []string {
+	return []string{"pull_request"}
+}
+
+func (h *deliveryHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	switch deliveryID {
+	case "gone":
+		return business.Permanent(errors.New("repository deleted"))
+	case "skipped":
+		return business.Ignored(errors.New("draft"))
+	}
+	if h.fail[deliveryID] {
+		return fmt.Errorf("handling %s: %w", deliveryID, errors.New("github fail whale"))
+	}
+	return nil
+}
+
+func sqsMessage(t *testing.T, id string, receiveCount string, d Delivery) events.SQSMessage {
+	body, err := json.Marshal(d)
+	assert.NoError(t, err)
+	return events.SQSMessage{
+		MessageId:  id,
+		Body:       string(body),
+		Attributes: map[string]string{"ApproximateReceiveCount": receiveCount},
+	}
+}
+
+func TestSQSWorker_Handle(t *testing.T) {
+	ok := Delivery{EventType: "pull_request", DeliveryID: "ok", Payload: json.RawMessage(`{}`)}
+	bad := Delivery{EventType: "pull_request", DeliveryID: "bad", Payload: json.RawMessage(`{}`)}
+	handler := &deliveryHandler{fail: map[string]bool{"bad": true}}
+	tests := []struct {
+		name            string
+		records         []events.SQSMessage
+		deadLetters     DeadLetterStore
+		wantFailures    []string
+		wantDeadLetters []string
+	}{
+		{
+			name: "failed message is retried",
+			records: []events.SQSMessage{
+				sqsMessage(t, "m1", "1", ok),
+				sqsMessage(t, "m2", "1", bad),
+			},
+			deadLetters:  &MemoryDeadLetterStore{},
+			wantFailures: []string{"m2"},
+		},
+		{
+			name: "exhausted message is dead lettered",
+			records: []events.SQSMessage{
+				sqsMessage(t, "m1", "3", bad),
+			},
+			deadLetters:     &MemoryDeadLetterStore{},
+			wantDeadLetters: []string{"bad"},
+		},
+		{
+			name: "permanent failure is dead lettered on first receive",
+			records: []events.SQSMessage{
+				sqsMessage(t, "m1", "1", Delivery{EventType: "pull_request", DeliveryID: "gone"}),
+			},
+			deadLetters:     &MemoryDeadLetterStore{},
+			wantDeadLetters: []string{"gone"},
+		},
+		{
+			name: "ignored delivery is acknowledged",
+			records: []events.SQSMessage{
+				sqsMessage(t, "m1", "1", Delivery{EventType: "pull_request", DeliveryID: "skipped"}),
+			},
+			deadLetters: &MemoryDeadLetterStore{},
+		},
+		{
+			name: "malformed message is dead lettered",
+			records: []events.SQSMessage{
+				{MessageId: "m1", Body: "not json"},
+			},
+			deadLetters:     &MemoryDeadLetterStore{},
+			wantDeadLetters: []string{"m1"},
+		},
+		{
+			name: "dead letter store failure keeps message",
+			records: []events.SQSMessage{
+				sqsMessage(t, "m1", "3", bad),
+			},
+			deadLetters:  &failingDeadLetterStore{},
+			wantFailures: []string{"m1"},
+		},
+		{
+			name: "without a dead letter store messages are left to the redrive policy",
+			records: []events.SQSMessage{
+				sqsMessage(t, "m1", "3", bad),
+				sqsMessage(t, "m2", "1", Delivery{EventType: "pull_request", DeliveryID: "gone"}),
+				{MessageId: "m3", Body: "not json"},
+			},
+			wantFailures: []string{"m1", "m2", "m3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &SQSWorker{Handler: handler, DeadLetters: tt.deadLetters, MaxAttempts: 3}
+			resp, err := w.Handle(context.Background(), events.SQSEvent{Records: tt.records})
+			assert.NoError(t, err)
+			var failures []string
+			for _, f := range resp.BatchItemFailures {
+				failures = append(failures, f.ItemIdentifier)
+			}
+			assert.Equal(t, tt.wantFailures, failures)
+			if mem, ok := tt.deadLetters.(*MemoryDeadLetterStore); ok {
+				var ids []string
+				for _, l := range mem.Letters() {
+					ids = append(ids, l.DeliveryID)
+					assert.NotEmpty(t, l.Errors)
+				}
+				assert.Equal(t, tt.wantDeadLetters, ids)
+			}
+		})
+	}
+}
+
+func TestNewDeadLetter(t *testing.T) {
+	d := Delivery{EventType: "pull_request", DeliveryID: "a", Payload: json.RawMessage(`{}`)}
+	err := fmt.Errorf("outer: %w", errors.New("inner"))
+	l := NewDeadLetter(d, 3, err)
+	assert.Equal(t, []string{"outer: inner", "inner"}, l.Errors)
+	assert.Equal(t, 3, l.Attempts)
+	assert.Equal(t, d, l.Delivery())
+}
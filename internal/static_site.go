@@ -0,0 +1,310 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/google/go-github/v47/github"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSiteTooLarge is returned for site artifacts over the size limit.
+var ErrSiteTooLarge = errors.New("site is too large")
+
+var hostLabelRE = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// siteState records which commit a preview site was last deployed from.
+type siteState struct {
+	HeadSHA   string    `json:"head_sha"`
+	URL       string    `json:"url"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// StaticSites hosts previews of static sites. Deploy copies the files under
+// SiteDir at the pull request head from the repository into an object store,
+// and ServeHTTP serves them back.
+//
+// Each commit's files are kept under their own prefix and a state object
+// points at the live one, so visitors never see a half uploaded site.
+// Previews whose URL is on a host matching Hosts are also indexed by host:
+//
+//	sites/<owner>/<repo>/<number>.json      the state of the preview
+//	sites/<owner>/<repo>/<number>/<sha>/... the files of each commit
+//	hosts/<host>                            the preview served on host
+type StaticSites struct {
+	Objects ObjectStore
+	// SiteDir is the repository directory holding the built site.
+	SiteDir string
+	// MaxBytes limits the total size of a site.
+	MaxBytes int64
+	// Hosts is a wildcard domain such as "*.previews.example.com" whose
+	// subdomains serve one preview each, or empty to only serve previews
+	// under PreviewsPath.
+	Hosts string
+	// Client downloads repository archives.
+	Client *http.Client
+	now    func() time.Time
+}
+
+func NewStaticSites(objects ObjectStore, siteDir string, maxBytes int64) *StaticSites {
+	return &StaticSites{
+		Objects:  objects,
+		SiteDir:  siteDir,
+		MaxBytes: maxBytes,
+		Client:   &http.Client{Timeout: time.Minute},
+		now:      time.Now,
+	}
+}
+
+func (s *StaticSites) stateKey(previewPath string) string {
+	return "sites/" + previewPath + ".json"
+}
+
+func (s *StaticSites) filesPrefix(previewPath string) string {
+	return "sites/" + previewPath + "/"
+}
+
+func (s *StaticSites) Deploy(ctx context.Context, client *github.Client, preview business.Preview) error {
+	state, ok, err := s.state(ctx, preview.Path())
+	if err != nil {
+		return err
+	}
+	if ok && state.HeadSHA == preview.HeadSHA && state.URL == preview.URL {
+		return nil
+	}
+
+	files, err := s.download(ctx, client, preview)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return business.Permanent(fmt.Errorf("no files under %s/ at %s", s.SiteDir, preview.HeadSHA))
+	}
+	prefix := s.filesPrefix(preview.Path()) + preview.HeadSHA + "/"
+	for name, body := range files {
+		if err := s.Objects.PutObject(ctx, prefix+name, body); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(siteState{HeadSHA: preview.HeadSHA, URL: preview.URL, UpdatedAt: s.now().UTC()})
+	if err != nil {
+		return err
+	}
+	if err := s.Objects.PutObject(ctx, s.stateKey(preview.Path()), b); err != nil {
+		return err
+	}
+	host, indexed := s.previewHost(preview.URL)
+	if indexed {
+		if err := s.Objects.PutObject(ctx, hostKey(host), []byte(preview.Path())); err != nil {
+			return err
+		}
+	}
+	// the preview no longer answers on the host of its previous URL.
+	if oldHost, oldIndexed := s.previewHost(state.URL); ok && oldIndexed && !(indexed && oldHost == host) {
+		if err := s.forgetHost(ctx, oldHost, preview.Path()); err != nil {
+			return err
+		}
+	}
+	// only the live commit's files are kept.
+	return s.deleteFiles(ctx, preview.Path(), preview.HeadSHA)
+}
+
+func (s *StaticSites) Destroy(ctx context.Context, client *github.Client, preview business.Preview) error {
+	state, ok, err := s.state(ctx, preview.Path())
+	if err != nil {
+		return err
+	}
+	if host, indexed := s.previewHost(state.URL); ok && indexed {
+		if err := s.forgetHost(ctx, host, preview.Path()); err != nil {
+			return err
+		}
+	}
+	if err := s.Objects.DeleteObject(ctx, s.stateKey(preview.Path())); err != nil {
+		return err
+	}
+	return s.deleteFiles(ctx, preview.Path(), "")
+}
+
+func (s *StaticSites) Status(ctx context.Context, client *github.Client, preview business.Preview) (business.PreviewState, bool, error) {
+	state, ok, err := s.state(ctx, preview.Path())
+	if err != nil || !ok {
+		return business.PreviewState{}, false, err
+	}
+	return business.PreviewState{HeadSHA: state.HeadSHA, URL: state.URL, UpdatedAt: state.UpdatedAt}, true, nil
+}
+
+func (s *StaticSites) Previews(ctx context.Context, owner, repo string) ([]int, error) {
+	prefix := "sites/" + business.RepoPath(owner, repo) + "/"
+	keys, err := s.Objects.ListObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var numbers []int
+	for _, key := range keys {
+		// only state objects sit directly under the repository's prefix.
+		name, ok := strings.CutSuffix(strings.TrimPrefix(key, prefix), ".json")
+		if !ok || strings.Contains(name, "/") {
+			continue
+		}
+		if number, err := strconv.Atoi(name); err == nil {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+func (s *StaticSites) state(ctx context.Context, previewPath string) (siteState, bool, error) {
+	b, err := s.Objects.GetObject(ctx, s.stateKey(previewPath))
+	if errors.Is(err, ErrObjectNotFound) {
+		return siteState{}, false, nil
+	}
+	if err != nil {
+		return siteState{}, false, err
+	}
+	var state siteState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return siteState{}, false, fmt.Errorf("%s: %w", s.stateKey(previewPath), err)
+	}
+	return state, true, nil
+}
+
+func hostKey(host string) string {
+	return "hosts/" + host
+}
+
+// previewHost returns the host of previewURL when it is served by host.
+func (s *StaticSites) previewHost(previewURL string) (string, bool) {
+	u, err := url.Parse(previewURL)
+	if err != nil {
+		return "", false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host, s.matchesHosts(host)
+}
+
+// matchesHosts reports whether host is a single label below the Hosts
+// wildcard domain.
+func (s *StaticSites) matchesHosts(host string) bool {
+	domain := strings.TrimPrefix(strings.ToLower(s.Hosts), "*")
+	if domain == "" || domain == strings.ToLower(s.Hosts) {
+		return false
+	}
+	label := strings.TrimSuffix(host, domain)
+	return label != host && hostLabelRE.MatchString(label)
+}
+
+// forgetHost drops the host index entry of a preview, unless another preview
+// took the host over since.
+func (s *StaticSites) forgetHost(ctx context.Context, host, previewPath string) error {
+	b, err := s.Objects.GetObject(ctx, hostKey(host))
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if string(b) != previewPath {
+		return nil
+	}
+	return s.Objects.DeleteObject(ctx, hostKey(host))
+}
+
+// deleteFiles removes the files of every commit of the preview but keep.
+func (s *StaticSites) deleteFiles(ctx context.Context, previewPath, keep string) error {
+	prefix := s.filesPrefix(previewPath)
+	keys, err := s.Objects.ListObjects(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if keep != "" && strings.HasPrefix(key, prefix+keep+"/") {
+			continue
+		}
+		if err := s.Objects.DeleteObject(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// download returns the files under SiteDir in the repository at the preview's
+// head commit, keyed by their path relative to SiteDir.
+func (s *StaticSites) download(ctx context.Context, client *github.Client, preview business.Preview) (map[string][]byte, error) {
+	link, _, err := client.Repositories.GetArchiveLink(ctx, preview.Owner, preview.Repo, github.Tarball,
+		&github.RepositoryContentGetOptions{Ref: preview.HeadSHA}, true)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, business.Retryable(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, business.Retryable(fmt.Errorf("downloading archive of %s: %s", preview.HeadSHA, resp.Status))
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return s.extract(tar.NewReader(gz))
+}
+
+// extract reads the site's regular files out of a repository tarball, whose
+// entries all sit under a single top-level directory.
+func (s *StaticSites) extract(tr *tar.Reader) (map[string][]byte, error) {
+	siteDir := strings.Trim(path.Clean("/"+s.SiteDir), "/")
+	files := make(map[string][]byte)
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			// links could point outside the site.
+			continue
+		}
+		_, name, ok := strings.Cut(hdr.Name, "/")
+		if !ok {
+			continue
+		}
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+		if siteDir != "" {
+			if !strings.HasPrefix(name, siteDir+"/") {
+				continue
+			}
+			name = strings.TrimPrefix(name, siteDir+"/")
+		}
+		total += hdr.Size
+		if total > s.MaxBytes {
+			return nil, business.Permanent(fmt.Errorf("%w: over %d bytes", ErrSiteTooLarge, s.MaxBytes))
+		}
+		body, err := io.ReadAll(io.LimitReader(tr, hdr.Size))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = body
+	}
+}
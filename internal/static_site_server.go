@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/rs/zerolog/log"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PreviewsPath is the route static site previews are served under, as
+// PreviewsPath + "owner/repo/number/".
+const PreviewsPath = "/previews/"
+
+// previewCSP sandboxes previews in an opaque origin, so the content of a pull
+// request cannot act as the app or as another preview sharing its host.
+// Scripts still run, as most sites need them.
+const previewCSP = "sandbox allow-scripts allow-forms allow-popups allow-modals"
+
+// ServeHTTP serves the files of static site previews under PreviewsPath.
+func (s *StaticSites) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, PreviewsPath), "/", 4)
+	if len(parts) < 3 {
+		http.NotFound(w, r)
+		return
+	}
+	number, err := strconv.Atoi(parts[2])
+	if err != nil || number <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 3 {
+		// relative links only resolve inside the preview with the slash.
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+	s.serve(w, r, business.PreviewPath(parts[0], parts[1], number), "/"+parts[3])
+}
+
+// serve answers r with the file at name in the live commit of the preview.
+// Directories serve their index.html, and paths without an extension that
+// match no file serve the site's root index.html, so single page apps can
+// route on the client.
+func (s *StaticSites) serve(w http.ResponseWriter, r *http.Request, previewPath, name string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Security-Policy", previewCSP)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	ctx := r.Context()
+	state, ok, err := s.state(ctx, previewPath)
+	if err != nil {
+		log.Ctx(ctx).Err(err).Str("preview", previewPath).Msg("failed to read preview state")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	prefix := s.filesPrefix(previewPath) + state.HeadSHA + "/"
+	name = strings.TrimPrefix(path.Clean(name), "/")
+	if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+	body, err := s.Objects.GetObject(ctx, prefix+name)
+	if errors.Is(err, ErrObjectNotFound) {
+		if _, err := s.Objects.GetObject(ctx, prefix+name+"/index.html"); err == nil {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		if path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		name = "index.html"
+		body, err = s.Objects.GetObject(ctx, prefix+name)
+	}
+	if errors.Is(err, ErrObjectNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Ctx(ctx).Err(err).Str("preview", previewPath).Str("file", name).Msg("failed to read preview file")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+	w.Header().Set("Content-Type", contentType)
+	// the same URL serves a new commit after every push.
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", strconv.Quote(state.HeadSHA))
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(body))
+}
+
+// RouteHosts serves requests to subdomains of Hosts from the preview indexed
+// under their host, and passes the others on to next.
+func (s *StaticSites) RouteHosts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.ToLower(r.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !s.matchesHosts(host) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		b, err := s.Objects.GetObject(r.Context(), hostKey(host))
+		if errors.Is(err, ErrObjectNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Ctx(r.Context()).Err(err).Str("host", host).Msg("failed to look up preview host")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		s.serve(w, r, string(b), r.URL.Path)
+	})
+}
+
+// RegisterStaticSiteServer serves static site previews when they are
+// provisioned by the app. It returns handler, routing requests to preview
+// hosts first when STATIC_SITE_HOSTS is set.
+func RegisterStaticSiteServer(config *Config, handler http.Handler) (http.Handler, error) {
+	if config.Provisioner != StaticProvisionerBackend {
+		return handler, nil
+	}
+	sites, err := config.ToStaticSites()
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Msg("registering route: static site previews")
+	http.Handle(PreviewsPath, sites)
+	if sites.Hosts == "" {
+		return handler, nil
+	}
+	log.Info().Str("hosts", sites.Hosts).Msg("routing preview hosts")
+	return sites.RouteHosts(handler), nil
+}
@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/google/go-github/v47/github"
+	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// tarball packs files like a GitHub repository archive, under a single
+// top-level directory.
+func tarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     "acme-site-abc123/" + name,
+			Mode:     0o644,
+			Size:     int64(len(body)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// archiveClient serves files as the archive of every commit.
+func archiveClient(t *testing.T, files map[string]string) *github.Client {
+	archive := tarball(t, files)
+	codeload := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	t.Cleanup(codeload.Close)
+	return github.NewClient(mock.NewMockedHTTPClient(
+		mock.WithRequestMatchHandler(mock.GetReposTarballByOwnerByRepoByRef, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Location", codeload.URL)
+			w.WriteHeader(http.StatusFound)
+		})),
+	))
+}
+
+func staticSites(t *testing.T) *StaticSites {
+	objects, err := NewLocalObjectStore(t.TempDir())
+	require.NoError(t, err)
+	return NewStaticSites(objects, "public", 1<<20)
+}
+
+func sitePreview(sha string) business.Preview {
+	return business.Preview{Owner: "Acme", Repo: "Site", Number: 7, HeadSHA: sha, URL: "https://app.example.com/previews/acme/site/7/"}
+}
+
+func TestStaticSites_Deploy(t *testing.T) {
+	ctx := context.Background()
+	sites := staticSites(t)
+	client := archiveClient(t, map[string]string{
+		"README.md":              "not part of the site",
+		"public/index.html":      "<h1>home</h1>",
+		"public/docs/index.html": "<h1>docs</h1>",
+	})
+
+	require.NoError(t, sites.Deploy(ctx, client, sitePreview("abc")))
+	state, ok, err := sites.Status(ctx, client, sitePreview("abc"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "abc", state.HeadSHA)
+	assert.Equal(t, "https://app.example.com/previews/acme/site/7/", state.URL)
+
+	keys, err := sites.Objects.ListObjects(ctx, "sites/acme/site/7/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sites/acme/site/7/abc/docs/index.html", "sites/acme/site/7/abc/index.html"}, keys)
+
+	// a new commit replaces the files of the old one.
+	require.NoError(t, sites.Deploy(ctx, client, sitePreview("def")))
+	keys, err = sites.Objects.ListObjects(ctx, "sites/acme/site/7/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sites/acme/site/7/def/docs/index.html", "sites/acme/site/7/def/index.html"}, keys)
+
+	numbers, err := sites.Previews(ctx, "acme", "site")
+	require.NoError(t, err)
+	assert.Equal(t, []int{7}, numbers)
+
+	require.NoError(t, sites.Destroy(ctx, client, sitePreview("def")))
+	_, ok, err = sites.Status(ctx, client, sitePreview("def"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	keys, err = sites.Objects.ListObjects(ctx, "sites/")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	numbers, err = sites.Previews(ctx, "acme", "site")
+	require.NoError(t, err)
+	assert.Empty(t, numbers)
+}
+
+func TestStaticSites_DeployErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		max   int64
+	}{
+		{name: "no site directory", files: map[string]string{"index.html": "home"}, max: 1 << 20},
+		{name: "too large", files: map[string]string{"public/index.html": "home"}, max: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sites := staticSites(t)
+			sites.MaxBytes = tt.max
+			err := sites.Deploy(context.Background(), archiveClient(t, tt.files), sitePreview("abc"))
+			assert.Equal(t, business.PermanentError, business.Classify(err))
+		})
+	}
+}
+
+func TestStaticSites_ServeHTTP(t *testing.T) {
+	sites := staticSites(t)
+	client := archiveClient(t, map[string]string{
+		"public/index.html":      "<h1>home</h1>",
+		"public/docs/index.html": "<h1>docs</h1>",
+		"public/app.js":          "console.log('hi')",
+		"public/logo.png":        "\x89PNG\r\n\x1a\n",
+		"public/LICENSE":         "plain text",
+	})
+	require.NoError(t, sites.Deploy(context.Background(), client, sitePreview("abc")))
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		wantStatus   int
+		wantType     string
+		wantBody     string
+		wantLocation string
+	}{
+		{name: "root", path: "/previews/acme/site/7/", wantStatus: 200, wantType: "text/html; charset=utf-8", wantBody: "<h1>home</h1>"},
+		{name: "root without slash", path: "/previews/acme/site/7", wantStatus: 301, wantLocation: "/previews/acme/site/7/"},
+		{name: "directory", path: "/previews/acme/site/7/docs/", wantStatus: 200, wantBody: "<h1>docs</h1>"},
+		{name: "directory without slash", path: "/previews/acme/site/7/docs", wantStatus: 301, wantLocation: "/previews/acme/site/7/docs/"},
+		{name: "script", path: "/previews/acme/site/7/app.js", wantStatus: 200, wantType: "text/javascript; charset=utf-8"},
+		{name: "image", path: "/previews/acme/site/7/logo.png", wantStatus: 200, wantType: "image/png"},
+		{name: "sniffed", path: "/previews/acme/site/7/LICENSE", wantStatus: 200, wantType: "text/plain; charset=utf-8"},
+		{name: "single page app route", path: "/previews/acme/site/7/users/42", wantStatus: 200, wantBody: "<h1>home</h1>"},
+		{name: "missing asset", path: "/previews/acme/site/7/missing.css", wantStatus: 404},
+		{name: "escaping the site", path: "/previews/acme/site/7/../../../etc/passwd", wantStatus: 200, wantBody: "<h1>home</h1>"},
+		{name: "unknown preview", path: "/previews/acme/site/8/", wantStatus: 404},
+		{name: "not a number", path: "/previews/acme/site/main/", wantStatus: 404},
+		{name: "post", method: http.MethodPost, path: "/previews/acme/site/7/", wantStatus: 405},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "http://app.example.com/", nil)
+			r.URL.Path = tt.path
+			w := httptest.NewRecorder()
+			sites.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantType != "" {
+				assert.Equal(t, tt.wantType, w.Header().Get("Content-Type"))
+				assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+				assert.Equal(t, previewCSP, w.Header().Get("Content-Security-Policy"))
+			}
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+			if tt.wantLocation != "" {
+				assert.Equal(t, tt.wantLocation, w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestStaticSites_RouteHosts(t *testing.T) {
+	ctx := context.Background()
+	sites := staticSites(t)
+	sites.Hosts = "*.previews.example.com"
+	client := archiveClient(t, map[string]string{
+		"public/index.html": "<h1>home</h1>",
+		"public/app.js":     "console.log('hi')",
+	})
+	preview := sitePreview("abc")
+	preview.URL = "https://pr-7--site.previews.example.com/"
+	require.NoError(t, sites.Deploy(ctx, client, preview))
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := sites.RouteHosts(next)
+	tests := []struct {
+		name       string
+		host       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "preview host", host: "pr-7--site.previews.example.com", path: "/", wantStatus: 200, wantBody: "<h1>home</h1>"},
+		{name: "preview host with port", host: "PR-7--site.previews.example.com:443", path: "/app.js", wantStatus: 200, wantBody: "console.log('hi')"},
+		{name: "unknown preview host", host: "pr-8--site.previews.example.com", path: "/", wantStatus: 404},
+		{name: "nested subdomain", host: "a.pr-7--site.previews.example.com", path: "/", wantStatus: http.StatusTeapot},
+		{name: "app host", host: "app.example.com", path: "/previews/acme/site/7/", wantStatus: http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://"+tt.host+tt.path, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+
+	require.NoError(t, sites.Destroy(ctx, client, preview))
+	keys, err := sites.Objects.ListObjects(ctx, "hosts/")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestStaticSites_DeployMovedHost(t *testing.T) {
+	ctx := context.Background()
+	sites := staticSites(t)
+	sites.Hosts = "*.previews.example.com"
+	client := archiveClient(t, map[string]string{"public/index.html": "<h1>home</h1>"})
+	preview := sitePreview("abc")
+	preview.URL = "https://pr-7--site.previews.example.com/"
+	require.NoError(t, sites.Deploy(ctx, client, preview))
+
+	// the URL pattern changed, so the same head is served on another host.
+	preview.URL = "https://site-7.previews.example.com/"
+	require.NoError(t, sites.Deploy(ctx, client, preview))
+	keys, err := sites.Objects.ListObjects(ctx, "hosts/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{hostKey("site-7.previews.example.com")}, keys)
+
+	// a path-based URL leaves no host behind.
+	preview.URL = "https://app.example.com/previews/acme/site/7/"
+	require.NoError(t, sites.Deploy(ctx, client, preview))
+	keys, err = sites.Objects.ListObjects(ctx, "hosts/")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
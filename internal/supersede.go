@@ -0,0 +1,324 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/go-github/v47/github"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Head store backends selectable in the configuration.
+const (
+	MemoryHeadStoreBackend   = "memory"
+	DynamoDBHeadStoreBackend = "dynamodb"
+)
+
+// ErrSuperseded marks work abandoned because a newer commit was pushed to the
+// pull request.
+var ErrSuperseded = errors.New("superseded by a newer commit")
+
+// HeadStore remembers the newest head commit seen for each pull request.
+// Heads are ordered by the pull request's updated_at timestamp rather than by
+// arrival, so late redeliveries cannot roll a pull request back. updated_at
+// only has a resolution of one second, so on a tie the head recorded first
+// is kept.
+type HeadStore interface {
+	// Advance records sha as the head of the pull request unless a head with
+	// the same or a later update time is already recorded, and returns the
+	// newest head.
+	Advance(ctx context.Context, key, sha string, updatedAt time.Time) (string, error)
+	// Close records that the pull request was closed at updatedAt, so that
+	// work for heads up to that time stays stale until it is reopened. The
+	// record expires with the store's TTL.
+	Close(ctx context.Context, key string, updatedAt time.Time) error
+	// Forget drops the recorded head once the app can no longer act on the
+	// pull request.
+	Forget(ctx context.Context, key string) error
+}
+
+type headRecord struct {
+	sha       string
+	updatedAt time.Time
+	expiresAt time.Time
+}
+
+func (r headRecord) expired(now time.Time) bool {
+	return !r.expiresAt.IsZero() && !now.Before(r.expiresAt)
+}
+
+// MemoryHeadStore keeps heads in process memory.
+type MemoryHeadStore struct {
+	mu    sync.Mutex
+	heads map[string]headRecord
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewMemoryHeadStore returns a store whose records expire ttl after the last
+// push or the close, or never when ttl is zero.
+func NewMemoryHeadStore(ttl time.Duration) *MemoryHeadStore {
+	return &MemoryHeadStore{heads: make(map[string]headRecord), ttl: ttl, now: time.Now}
+}
+
+func (s *MemoryHeadStore) Advance(ctx context.Context, key, sha string, updatedAt time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.advance(key, sha, updatedAt, false), nil
+}
+
+func (s *MemoryHeadStore) Close(ctx context.Context, key string, updatedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// closing is rare enough to drop every expired record along the way.
+	now := s.now()
+	for k, record := range s.heads {
+		if record.expired(now) {
+			delete(s.heads, k)
+		}
+	}
+	s.advance(key, "", updatedAt, true)
+	return nil
+}
+
+// advance records sha unless an unexpired record is newer, or as new and
+// tie is false. Callers must hold mu.
+func (s *MemoryHeadStore) advance(key, sha string, updatedAt time.Time, tie bool) string {
+	now := s.now()
+	if current, ok := s.heads[key]; ok && !current.expired(now) && !wins(updatedAt, current.updatedAt, tie) {
+		return current.sha
+	}
+	record := headRecord{sha: sha, updatedAt: updatedAt}
+	if s.ttl > 0 {
+		record.expiresAt = now.Add(s.ttl)
+	}
+	s.heads[key] = record
+	return sha
+}
+
+func (s *MemoryHeadStore) Forget(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.heads, key)
+	return nil
+}
+
+// DynamoDBHeadStore keeps heads in a DynamoDB-style table, using conditional
+// writes so concurrent invocations agree on the newest head.
+type DynamoDBHeadStore struct {
+	table DynamoTable
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+// NewDynamoDBHeadStore returns a store whose records expire ttl after the
+// last push, for pull requests that are never closed.
+func NewDynamoDBHeadStore(table DynamoTable, ttl time.Duration) *DynamoDBHeadStore {
+	return &DynamoDBHeadStore{table: table, ttl: ttl, now: time.Now}
+}
+
+func (s *DynamoDBHeadStore) key(key string) string {
+	return "head#" + key
+}
+
+func (s *DynamoDBHeadStore) Advance(ctx context.Context, key, sha string, updatedAt time.Time) (string, error) {
+	return s.advance(ctx, key, sha, updatedAt, false)
+}
+
+// Close records the close as a head without a commit, which expires like any
+// other head.
+func (s *DynamoDBHeadStore) Close(ctx context.Context, key string, updatedAt time.Time) error {
+	_, err := s.advance(ctx, key, "", updatedAt, true)
+	return err
+}
+
+func (s *DynamoDBHeadStore) advance(ctx context.Context, key, sha string, updatedAt time.Time, tie bool) (string, error) {
+	item := DynamoItem{
+		Key:       s.key(key),
+		Value:     updatedAt.UTC().Format(time.RFC3339Nano) + " " + sha,
+		ExpiresAt: s.now().Add(s.ttl),
+	}
+	// retry when another writer wins the race between the read and the
+	// conditional write.
+	for attempt := 0; attempt < 5; attempt++ {
+		current, ok, err := s.table.GetItem(ctx, item.Key)
+		if err != nil {
+			return "", err
+		}
+		var written bool
+		if ok {
+			currentSHA, currentUpdatedAt, parseErr := parseHeadValue(current.Value)
+			if parseErr != nil {
+				return "", parseErr
+			}
+			if !wins(updatedAt, currentUpdatedAt, tie) {
+				return currentSHA, nil
+			}
+			written, err = s.table.PutItemIfValue(ctx, item, current.Value)
+		} else {
+			written, err = s.table.PutItemIfAbsent(ctx, item)
+		}
+		if err != nil {
+			return "", err
+		}
+		if written {
+			return sha, nil
+		}
+	}
+	return "", fmt.Errorf("could not record head of %s", key)
+}
+
+func (s *DynamoDBHeadStore) Forget(ctx context.Context, key string) error {
+	return s.table.DeleteItem(ctx, s.key(key))
+}
+
+// wins reports whether a head updated at updatedAt replaces one updated at
+// current. Closing wins a tie, as nothing may deploy after it.
+func wins(updatedAt, current time.Time, tie bool) bool {
+	return updatedAt.After(current) || tie && updatedAt.Equal(current)
+}
+
+func parseHeadValue(value string) (string, time.Time, error) {
+	ts, sha, ok := strings.Cut(value, " ")
+	if !ok {
+		return "", time.Time{}, fmt.Errorf("malformed head record %q", value)
+	}
+	updatedAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("malformed head record %q: %w", value, err)
+	}
+	return sha, updatedAt, nil
+}
+
+// supersedable reports whether an action deploys the pull request head, so
+// that it can be skipped or cancelled once a newer head arrives. Teardown
+// actions always run.
+func supersedable(action string) bool {
+	switch action {
+	case OpenedAction, ReopenedAction, SynchronizeAction, ReadyForReviewAction, UnlabeledAction, EditedAction:
+		return true
+	}
+	return false
+}
+
+type inflight struct {
+	sha    string
+	cancel context.CancelFunc
+	// superseded is set before cancel is called.
+	superseded bool
+}
+
+// Superseder skips and cancels deployments of pull request heads that are
+// no longer the newest, so an older preview never overwrites a newer one.
+// Queued work is skipped through the HeadStore; running work in this
+// process is cancelled through its context.
+type Superseder struct {
+	Heads HeadStore
+
+	mu      sync.Mutex
+	running map[string][]*inflight
+}
+
+// SupersedeRun tracks the work done for one pull request event.
+type SupersedeRun struct {
+	ctx   context.Context
+	stale bool
+	s     *Superseder
+	key   string
+	entry *inflight
+}
+
+// Begin records the event's head and starts tracking its work. The run is
+// stale when a newer head was already seen; otherwise older deployments of
+// the same pull request still running are cancelled. A nil Superseder
+// tracks nothing.
+func (s *Superseder) Begin(ctx context.Context, event github.PullRequestEvent) (*SupersedeRun, error) {
+	run := &SupersedeRun{ctx: ctx}
+	pr := event.GetPullRequest()
+	sha := pr.GetHead().GetSHA()
+	if s == nil || sha == "" {
+		return run, nil
+	}
+	run.s = s
+	run.key = PRLockKey(event.GetRepo().GetFullName(), event.GetNumber())
+	if event.GetAction() == ClosedAction {
+		// keep stale deliveries that arrive after the close from deploying
+		// the preview again.
+		return run, s.Heads.Close(ctx, run.key, pr.GetUpdatedAt())
+	}
+
+	newest, err := s.Heads.Advance(ctx, run.key, sha, pr.GetUpdatedAt())
+	if err != nil {
+		return run, err
+	}
+	if !supersedable(event.GetAction()) {
+		return run, nil
+	}
+	if newest != sha {
+		run.stale = true
+		return run, nil
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	run.ctx = runCtx
+	run.entry = &inflight{sha: sha, cancel: cancel}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running == nil {
+		s.running = make(map[string][]*inflight)
+	}
+	for _, other := range s.running[run.key] {
+		if other.sha != sha && !other.superseded {
+			other.superseded = true
+			other.cancel()
+		}
+	}
+	s.running[run.key] = append(s.running[run.key], run.entry)
+	return run, nil
+}
+
+// Context returns the context to do the work under. It is cancelled when a
+// newer head supersedes the run.
+func (r *SupersedeRun) Context() context.Context {
+	return r.ctx
+}
+
+// Stale reports whether a newer head had already been seen when the run
+// began, so the work must be skipped.
+func (r *SupersedeRun) Stale() bool {
+	return r.stale
+}
+
+// Superseded reports whether the run was cancelled by a newer head.
+func (r *SupersedeRun) Superseded() bool {
+	if r.entry == nil {
+		return false
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	return r.entry.superseded
+}
+
+// Done stops tracking the run.
+func (r *SupersedeRun) Done() {
+	if r.entry == nil {
+		return
+	}
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	r.entry.cancel()
+	entries := r.s.running[r.key]
+	for i, e := range entries {
+		if e == r.entry {
+			entries = append(entries[:i], entries[i+1:]...)
+			break
+		}
+	}
+	if len(entries) == 0 {
+		delete(r.s.running, r.key)
+	} else {
+		r.s.running[r.key] = entries
+	}
+}
@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"context"
+	"github.com/google/go-github/v47/github"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func headStores() map[string]HeadStore {
+	return map[string]HeadStore{
+		"memory":   NewMemoryHeadStore(time.Hour),
+		"dynamodb": NewDynamoDBHeadStore(NewMemoryDynamoTable(), time.Hour),
+	}
+}
+
+func TestHeadStores(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+	for name, store := range headStores() {
+		t.Run(name, func(t *testing.T) {
+			newest, err := store.Advance(ctx, "pr", "aaa", start)
+			assert.NoError(t, err)
+			assert.Equal(t, "aaa", newest)
+
+			newest, err = store.Advance(ctx, "pr", "bbb", start.Add(time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, "bbb", newest, "later push wins")
+
+			newest, err = store.Advance(ctx, "pr", "aaa", start)
+			assert.NoError(t, err)
+			assert.Equal(t, "bbb", newest, "late redelivery does not roll back")
+
+			newest, err = store.Advance(ctx, "pr", "bbb", start.Add(time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, "bbb", newest, "same head again")
+
+			newest, err = store.Advance(ctx, "pr", "ccc", start.Add(time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, "bbb", newest, "the first head wins a tie")
+
+			assert.NoError(t, store.Close(ctx, "pr", start.Add(2*time.Minute)))
+			newest, err = store.Advance(ctx, "pr", "bbb", start.Add(time.Minute))
+			assert.NoError(t, err)
+			assert.Empty(t, newest, "late delivery after the close")
+			newest, err = store.Advance(ctx, "pr", "bbb", start.Add(3*time.Minute))
+			assert.NoError(t, err)
+			assert.Equal(t, "bbb", newest, "reopened")
+
+			assert.NoError(t, store.Forget(ctx, "pr"))
+			newest, err = store.Advance(ctx, "pr", "aaa", start)
+			assert.NoError(t, err)
+			assert.Equal(t, "aaa", newest, "after forget")
+		})
+	}
+}
+
+func TestMemoryHeadStore_expiry(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+	now := start
+	store := NewMemoryHeadStore(time.Hour)
+	store.now = func() time.Time { return now }
+
+	assert.NoError(t, store.Close(ctx, "closed", start))
+	_, err := store.Advance(ctx, "open", "aaa", start)
+	assert.NoError(t, err)
+
+	now = start.Add(2 * time.Hour)
+	newest, err := store.Advance(ctx, "closed", "aaa", start)
+	assert.NoError(t, err)
+	assert.Equal(t, "aaa", newest, "the close expired")
+
+	assert.NoError(t, store.Close(ctx, "other", start))
+	assert.NotContains(t, store.heads, "open", "closing drops expired heads")
+}
+
+func headEvent(action, sha string, updatedAt time.Time) github.PullRequestEvent {
+	return github.PullRequestEvent{
+		Action: github.String(action),
+		Number: github.Int(1),
+		Repo:   &github.Repository{FullName: github.String("acme/web")},
+		PullRequest: &github.PullRequest{
+			Head:      &github.PullRequestBranch{SHA: github.String(sha)},
+			UpdatedAt: &updatedAt,
+		},
+	}
+}
+
+func TestSuperseder_Begin(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+	s := &Superseder{Heads: NewMemoryHeadStore(time.Hour)}
+
+	first, err := s.Begin(ctx, headEvent(OpenedAction, "aaa", start))
+	assert.NoError(t, err)
+	assert.False(t, first.Stale())
+
+	// a newer push cancels the running deployment of the older head.
+	second, err := s.Begin(ctx, headEvent(SynchronizeAction, "bbb", start.Add(time.Minute)))
+	assert.NoError(t, err)
+	assert.False(t, second.Stale())
+	assert.Error(t, first.Context().Err())
+	assert.True(t, first.Superseded())
+	assert.NoError(t, second.Context().Err())
+	assert.False(t, second.Superseded())
+	first.Done()
+
+	// queued work for the older head is skipped.
+	queued, err := s.Begin(ctx, headEvent(SynchronizeAction, "aaa", start))
+	assert.NoError(t, err)
+	assert.True(t, queued.Stale())
+
+	// teardown actions always run and never cancel deployments.
+	teardown, err := s.Begin(ctx, headEvent(ConvertedToDraftAction, "aaa", start))
+	assert.NoError(t, err)
+	assert.False(t, teardown.Stale())
+	assert.NoError(t, second.Context().Err())
+	teardown.Done()
+
+	second.Done()
+	assert.Empty(t, s.running)
+
+	closed, err := s.Begin(ctx, headEvent(ClosedAction, "bbb", start.Add(time.Minute)))
+	assert.NoError(t, err)
+	assert.False(t, closed.Stale())
+	late, err := s.Begin(ctx, headEvent(SynchronizeAction, "bbb", start.Add(time.Minute)))
+	assert.NoError(t, err)
+	assert.True(t, late.Stale(), "a delivery arriving after the close is skipped")
+	reopened, err := s.Begin(ctx, headEvent(ReopenedAction, "bbb", start.Add(2*time.Minute)))
+	assert.NoError(t, err)
+	assert.False(t, reopened.Stale())
+	reopened.Done()
+}
+
+func TestSuperseder_Begin_nil(t *testing.T) {
+	var s *Superseder
+	ctx := context.Background()
+	run, err := s.Begin(ctx, headEvent(OpenedAction, "aaa", time.Now()))
+	assert.NoError(t, err)
+	assert.False(t, run.Stale())
+	assert.False(t, run.Superseded())
+	assert.Equal(t, ctx, run.Context())
+	run.Done()
+}
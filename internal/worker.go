@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"context"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog/log"
+	"sync"
+	"time"
+)
+
+// Worker processes queued deliveries, retrying retryable failures with
+// exponential backoff.
+type Worker struct {
+	Handler     githubapp.EventHandler
+	MaxAttempts int
+	Backoff     time.Duration
+	// DeadLetters receives deliveries that Run gives up on.
+	DeadLetters DeadLetterStore
+}
+
+// Process runs a delivery until it succeeds, the attempts are exhausted or
+// ctx is done, and returns the last error.
+func (w *Worker) Process(ctx context.Context, d Delivery) error {
+	logger := log.With().
+		Str("event", d.EventType).
+		Str("delivery", d.DeliveryID).
+		Logger()
+	ctx = logger.WithContext(ctx)
+	attempts := w.attempts()
+	backoff := w.Backoff
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = w.Handler.Handle(ctx, d.EventType, d.DeliveryID, d.Payload); err == nil {
+			return nil
+		}
+		kind := business.Classify(err)
+		if kind == business.IgnoredError {
+			logger.Info().Err(err).Msg("delivery ignored")
+			return nil
+		}
+		logger.Err(err).Int("attempt", attempt).Str("error_kind", kind.String()).Msg("failed to process delivery")
+		if attempt == attempts || kind == business.PermanentError {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+func (w *Worker) attempts() int {
+	if w.MaxAttempts < 1 {
+		return 1
+	}
+	return w.MaxAttempts
+}
+
+// Run starts n workers consuming the queue and blocks until ctx is done and
+// in-flight deliveries have finished.
+func (w *Worker) Run(ctx context.Context, q *MemoryQueue, n int) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-q.Deliveries():
+					if err := w.Process(ctx, d); err != nil {
+						w.giveUp(ctx, d, err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *Worker) giveUp(ctx context.Context, d Delivery, err error) {
+	log.Err(err).Str("delivery", d.DeliveryID).Msg("giving up on delivery")
+	if w.DeadLetters == nil {
+		return
+	}
+	if err := w.DeadLetters.Put(ctx, NewDeadLetter(d, w.attempts(), err)); err != nil {
+		log.Err(err).Str("delivery", d.DeliveryID).Msg("failed to store dead letter")
+	}
+}
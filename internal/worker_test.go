@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"github.com/ehenry2/gh-app-pr-hello/business"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// flakyHandler fails the first n calls.
+type flakyHandler struct {
+	countingHandler
+	failures int
+}
+
+func (h *flakyHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	h.calls++
+	if h.calls <= h.failures {
+		return errors.New("github fail whale")
+	}
+	return nil
+}
+
+func TestWorker_Process(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int
+		maxAttempts int
+		wantCalls   int
+		wantErr     assert.ErrorAssertionFunc
+	}{
+		{name: "first attempt", failures: 0, maxAttempts: 3, wantCalls: 1, wantErr: assert.NoError},
+		{name: "succeeds on retry", failures: 2, maxAttempts: 3, wantCalls: 3, wantErr: assert.NoError},
+		{name: "gives up", failures: 5, maxAttempts: 3, wantCalls: 3, wantErr: assert.Error},
+		{name: "at least one attempt", failures: 5, maxAttempts: 0, wantCalls: 1, wantErr: assert.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &flakyHandler{failures: tt.failures}
+			w := &Worker{Handler: h, MaxAttempts: tt.maxAttempts, Backoff: time.Millisecond}
+			tt.wantErr(t, w.Process(context.Background(), Delivery{DeliveryID: "a"}))
+			assert.Equal(t, tt.wantCalls, h.calls)
+		})
+	}
+}
+
+func TestWorker_ProcessClassified(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr assert.ErrorAssertionFunc
+	}{
+		{name: "permanent is not retried", err: business.Permanent(errors.New("gone")), wantErr: assert.Error},
+		{name: "ignored is not an error", err: business.Ignored(errors.New("draft")), wantErr: assert.NoError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &countingHandler{err: tt.err}
+			w := &Worker{Handler: h, MaxAttempts: 3, Backoff: time.Millisecond}
+			tt.wantErr(t, w.Process(context.Background(), Delivery{DeliveryID: "a"}))
+			assert.Equal(t, 1, h.calls)
+		})
+	}
+}
+
+func TestWorker_ProcessCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	h := &flakyHandler{failures: 5}
+	w := &Worker{Handler: h, MaxAttempts: 3, Backoff: time.Hour}
+	assert.ErrorIs(t, w.Process(ctx, Delivery{DeliveryID: "a"}), context.Canceled)
+	assert.Equal(t, 1, h.calls)
+}
+
+func TestWorker_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &flakyHandler{}
+	q := NewMemoryQueue(2)
+	assert.NoError(t, q.Enqueue(ctx, Delivery{DeliveryID: "a"}))
+	assert.NoError(t, q.Enqueue(ctx, Delivery{DeliveryID: "b"}))
+	w := &Worker{Handler: h, MaxAttempts: 1}
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx, q, 1)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return len(q.Deliveries()) == 0 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, 2, h.calls)
+}
+
+func TestWorker_RunDeadLetters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &flakyHandler{failures: 5}
+	q := NewMemoryQueue(1)
+	assert.NoError(t, q.Enqueue(ctx, Delivery{EventType: "pull_request", DeliveryID: "a"}))
+	deadLetters := &MemoryDeadLetterStore{}
+	w := &Worker{Handler: h, MaxAttempts: 2, Backoff: time.Millisecond, DeadLetters: deadLetters}
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx, q, 1)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return len(deadLetters.Letters()) == 1 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	l := deadLetters.Letters()[0]
+	assert.Equal(t, "a", l.DeliveryID)
+	assert.Equal(t, 2, l.Attempts)
+	assert.Equal(t, []string{"github fail whale"}, l.Errors)
+}